@@ -1,15 +1,23 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/gin-gonic/gin"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/nutslove/otel-instrumentation-demo/go-common/propcheck"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/sqlcomment"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/telemetry"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/tracelog"
 )
 
 var db *sql.DB
@@ -27,13 +35,19 @@ type PricingResponse struct {
 }
 
 func initDB() error {
-	var err error
-	db, err = sql.Open("sqlite3", "/data/pricing.db")
-	if err != nil {
-		return err
+	// Statements carry a sqlcommenter comment with the request's trace
+	// context and route; SQL_QUERY_LOG names a file logging them as sent.
+	var queryLog *sqlcomment.QueryLog
+	if path := os.Getenv("SQL_QUERY_LOG"); path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		queryLog = sqlcomment.NewQueryLog(f)
 	}
+	db = sqlcomment.Open(&sqlite3.SQLiteDriver{}, "/data/pricing.db", queryLog)
 
-	_, err = db.Exec(`
+	_, err := db.Exec(`
 		CREATE TABLE IF NOT EXISTS pricing (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			product_name TEXT NOT NULL UNIQUE,
@@ -54,6 +68,26 @@ func initDB() error {
 }
 
 func main() {
+	// JSON logs with trace_id/span_id of the incoming trace headers, as the
+	// service records no spans of its own
+	slog.SetDefault(slog.New(tracelog.NewHandler(slog.NewJSONHandler(os.Stdout, nil))))
+
+	// The eBPF agent records spans from outside the process, but no
+	// metrics. OTEL_METRICS_EXPORTER=otlp (or prometheus) turns on Go
+	// runtime, process and host metrics from a MeterProvider of the
+	// service's own, which propcheck records on too
+	// On ECS the service runs in place of go-service, so its metrics share
+	// go-service's service.name
+	mp, shutdownMetrics, err := telemetry.NewMeterProvider(context.Background(), telemetry.Config{
+		ServiceName:    "go-gin-service",
+		RuntimeMetrics: true,
+		HostMetrics:    true,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize metrics: %v", err)
+	}
+	defer shutdownMetrics(context.Background())
+
 	// Initialize database
 	if err := initDB(); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
@@ -65,6 +99,28 @@ func main() {
 	r := gin.New()
 	r.Use(gin.Recovery())
 
+	// Adds trace_id/span_id from the incoming trace headers to request logs
+	// and SQL comments
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(tracelog.Extract(c.Request.Context(), c.Request.Header))
+		c.Next()
+	})
+
+	// Adds the sqlcommenter route to the request's SQL statements
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(sqlcomment.ContextWithRoute(c.Request.Context(), c.FullPath()))
+		c.Next()
+	})
+
+	// Counts the requests arriving with and without a trace context
+	propagation, err := propcheck.New(propcheck.Config{
+		Exclude:       []string{"/health", "/debug/"},
+		MeterProvider: mp,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize propagation check: %v", err)
+	}
+
 	// CORS
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
@@ -78,7 +134,7 @@ func main() {
 	})
 
 	r.GET("/", func(c *gin.Context) {
-		log.Println("Go service root endpoint called")
+		slog.InfoContext(c.Request.Context(), "Go service root endpoint called")
 		c.JSON(http.StatusOK, gin.H{
 			"service": "go-gin-ebpf",
 			"status":  "running",
@@ -88,23 +144,23 @@ func main() {
 	r.POST("/pricing/calculate", func(c *gin.Context) {
 		var req PricingRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			log.Printf("Invalid request: %v", err)
+			slog.WarnContext(c.Request.Context(), fmt.Sprintf("Invalid request: %v", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		log.Printf("Calculating pricing for %s (quantity: %d)", req.ProductName, req.Quantity)
+		slog.InfoContext(c.Request.Context(), fmt.Sprintf("Calculating pricing for %s (quantity: %d)", req.ProductName, req.Quantity))
 
 		var unitPrice float64
 		err := db.QueryRowContext(c.Request.Context(), "SELECT unit_price FROM pricing WHERE product_name = ?", req.ProductName).Scan(&unitPrice)
 		if err != nil {
-			log.Printf("Database error: %v", err)
+			slog.ErrorContext(c.Request.Context(), fmt.Sprintf("Database error: %v", err))
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
 		}
 
 		totalPrice := unitPrice * float64(req.Quantity)
-		log.Printf("Pricing calculated: %.2f", totalPrice)
+		slog.InfoContext(c.Request.Context(), fmt.Sprintf("Pricing calculated: %.2f", totalPrice))
 
 		c.JSON(http.StatusOK, PricingResponse{
 			ProductName: req.ProductName,
@@ -115,11 +171,11 @@ func main() {
 	})
 
 	r.GET("/pricing", func(c *gin.Context) {
-		log.Println("Fetching all pricing")
+		slog.InfoContext(c.Request.Context(), "Fetching all pricing")
 
 		rows, err := db.QueryContext(c.Request.Context(), "SELECT * FROM pricing")
 		if err != nil {
-			log.Printf("Database error: %v", err)
+			slog.ErrorContext(c.Request.Context(), fmt.Sprintf("Database error: %v", err))
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -140,7 +196,7 @@ func main() {
 			})
 		}
 
-		log.Printf("Retrieved %d pricing items", len(pricing))
+		slog.InfoContext(c.Request.Context(), fmt.Sprintf("Retrieved %d pricing items", len(pricing)))
 
 		c.JSON(http.StatusOK, gin.H{
 			"pricing": pricing,
@@ -151,8 +207,10 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 	})
 
+	r.GET("/debug/propagation", gin.WrapH(propagation))
+
 	r.GET("/error", func(c *gin.Context) {
-		log.Println("Intentional error triggered")
+		slog.ErrorContext(c.Request.Context(), "Intentional error triggered")
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Intentional error for testing",
 		})
@@ -161,23 +219,23 @@ func main() {
 	r.POST("/pricing/calculate/error", func(c *gin.Context) {
 		var req PricingRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			log.Printf("Invalid request: %v", err)
+			slog.WarnContext(c.Request.Context(), fmt.Sprintf("Invalid request: %v", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		log.Printf("Intentional pricing error for %s", req.ProductName)
+		slog.ErrorContext(c.Request.Context(), fmt.Sprintf("Intentional pricing error for %s", req.ProductName))
 
 		var unitPrice float64
 		err := db.QueryRowContext(c.Request.Context(), "SELECT unit_price FROM pricing WHERE product_name = ?", req.ProductName).Scan(&unitPrice)
 		if err != nil {
-			log.Printf("Database error: %v", err)
+			slog.ErrorContext(c.Request.Context(), fmt.Sprintf("Database error: %v", err))
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
 		}
 
 		totalPrice := unitPrice * float64(req.Quantity)
-		log.Printf("Pricing calculation error (intentional): %.2f", totalPrice)
+		slog.ErrorContext(c.Request.Context(), fmt.Sprintf("Pricing calculation error (intentional): %.2f", totalPrice))
 
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":        "Intentional pricing calculation error",
@@ -192,7 +250,7 @@ func main() {
 	// Start server
 	srv := &http.Server{
 		Addr:    ":8080",
-		Handler: r,
+		Handler: propagation.Handler(r),
 	}
 
 	go func() {
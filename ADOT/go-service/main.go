@@ -8,28 +8,30 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	"github.com/gin-gonic/gin"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 
-	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
-	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
 	"go.opentelemetry.io/otel/trace"
-	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
-)
 
-var (
-	db     *sql.DB
-	tracer trace.Tracer
+	"github.com/nutslove/otel-instrumentation-demo/go-common/ecs"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/propcheck"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/sqlcomment"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/telemetry"
 )
 
+var db *sql.DB
+
 type PricingRequest struct {
 	ProductName string `json:"product_name"`
 	Quantity    int    `json:"quantity"`
@@ -43,51 +45,40 @@ type PricingResponse struct {
 }
 
 func initTelemetry(ctx context.Context) (func(), error) {
-	// Get OTLP endpoint from environment variable
-	otlpEndpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if otlpEndpoint == "" {
-		otlpEndpoint = "localhost:4318" // Default fallback
-	}
-	// Remove http:// or https:// prefix if present
-	otlpEndpoint = fmt.Sprintf("%s", otlpEndpoint)
-	if len(otlpEndpoint) > 7 && otlpEndpoint[:7] == "http://" {
-		otlpEndpoint = otlpEndpoint[7:]
-	} else if len(otlpEndpoint) > 8 && otlpEndpoint[:8] == "https://" {
-		otlpEndpoint = otlpEndpoint[8:]
+	log.Printf("Initializing OpenTelemetry with endpoint: %s", os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+
+	// Defaults below are overridden by the standard OTEL_* environment variables
+	cfg := telemetry.Config{
+		ServiceName:    "go-gin-service",
+		ServiceVersion: "1.0.0",
+		Endpoint:       telemetry.DefaultEndpoint,
+		GRPCEndpoint:   telemetry.DefaultGRPCEndpoint,
+		Traces:         true,
+		Detectors:      []resource.Detector{ecs.NewDetector()},
 	}
 
-	log.Printf("Initializing OpenTelemetry with endpoint: %s", otlpEndpoint)
-
-	// Resource
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName("go-gin-service"),
-			semconv.ServiceVersion("1.0.0"),
-		),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create resource: %w", err)
+	// X-Ray mode: trace IDs start with the epoch seconds X-Ray requires, and
+	// the X-Amzn-Trace-Id set by the ALB is continued (xray is extracted last,
+	// so it wins over traceparent) and forwarded next to traceparent.
+	xrayMode := true
+	if v := os.Getenv("XRAY_MODE"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid XRAY_MODE %q: %w", v, err)
+		}
+		xrayMode = b
+	}
+	if xrayMode {
+		cfg.IDGenerator = xray.NewIDGenerator()
+		cfg.Propagators = []string{"tracecontext", "baggage", "xray"}
+		log.Printf("X-Ray mode enabled")
 	}
 
-	// Trace exporter
-	traceExporter, err := otlptracehttp.New(ctx,
-		otlptracehttp.WithEndpoint(otlpEndpoint),
-		otlptracehttp.WithInsecure(),
-	)
+	tel, err := telemetry.New(ctx, cfg)
 	if err != nil {
-		log.Printf("Failed to create trace exporter: %v", err)
-		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+		log.Printf("Failed to initialize telemetry: %v", err)
+		return nil, err
 	}
-	log.Printf("OTLP trace exporter initialized successfully")
-
-	// Trace provider
-	tracerProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(traceExporter),
-		sdktrace.WithResource(res),
-	)
-	otel.SetTracerProvider(tracerProvider)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-	tracer = tracerProvider.Tracer("go-service-tracer")
 	log.Printf("TracerProvider initialized successfully")
 
 	// Cleanup function
@@ -95,7 +86,7 @@ func initTelemetry(ctx context.Context) (func(), error) {
 		log.Printf("Shutting down TracerProvider...")
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
-		if err := tracerProvider.Shutdown(ctx); err != nil {
+		if err := tel.Shutdown(ctx); err != nil {
 			log.Printf("Error shutting down tracer provider: %v", err)
 		} else {
 			log.Printf("TracerProvider shutdown complete")
@@ -105,13 +96,29 @@ func initTelemetry(ctx context.Context) (func(), error) {
 	return cleanup, nil
 }
 
-func initDB() error {
+func initDB(path string) error {
 	var err error
-	db, err = sql.Open("sqlite3", "/data/pricing.db")
-	if err != nil {
-		return err
+
+	// Optional query log with every statement as sent and its duration
+	var queryLog *sqlcomment.QueryLog
+	if path := os.Getenv("SQL_QUERY_LOG"); path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		queryLog = sqlcomment.NewQueryLog(f)
 	}
 
+	// Every statement becomes a span covering its rows until they are
+	// closed. The sqlcomment connector underneath gets the DB span's
+	// context, so statements carry a sqlcommenter comment with its
+	// traceparent and the route
+	db = otelsql.OpenDB(sqlcomment.NewConnector(&sqlite3.SQLiteDriver{}, path, queryLog),
+		otelsql.WithAttributes(semconv.DBSystemNameSQLite),
+		otelsql.WithSpanNameFormatter(dbSpanName),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{DisableErrSkip: true, OmitConnResetSession: true}),
+	)
+
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS pricing (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -132,6 +139,15 @@ func initDB() error {
 	return err
 }
 
+// dbSpanName names DB spans after the SQL operation, e.g. "SELECT", and
+// other calls such as transactions after the otelsql method.
+func dbSpanName(_ context.Context, method otelsql.Method, query string) string {
+	if operation, _, _ := strings.Cut(strings.TrimSpace(query), " "); operation != "" {
+		return strings.ToUpper(operation)
+	}
+	return string(method)
+}
+
 func main() {
 	ctx := context.Background()
 
@@ -143,17 +159,29 @@ func main() {
 	defer cleanup()
 
 	// Initialize database
-	if err := initDB(); err != nil {
+	if err := initDB("/data/pricing.db"); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
 
+	// Counts the requests arriving with and without a trace context
+	propagation, err := propcheck.New(propcheck.Config{Exclude: []string{"/health", "/debug/"}})
+	if err != nil {
+		log.Fatalf("Failed to initialize propagation check: %v", err)
+	}
+
 	// Setup Gin
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(gin.Recovery())
 	r.Use(otelgin.Middleware("go-gin-service"))
 
+	// Route for the sqlcommenter comments of the request's statements
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(sqlcomment.ContextWithRoute(c.Request.Context(), c.FullPath()))
+		c.Next()
+	})
+
 	// CORS
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
@@ -192,19 +220,11 @@ func main() {
 		}
 
 		log.Printf("Calculating pricing for %s (quantity: %d) - trace_id: %s", req.ProductName, req.Quantity, traceID)
+		span.SetAttributes(attribute.String("product.name", req.ProductName))
 
-		// Database query with span
-		dbCtx, dbSpan := tracer.Start(ctx, "db_select_pricing",
-			trace.WithAttributes(
-				attribute.String("db.operation", "select"),
-				attribute.String("db.table", "pricing"),
-				attribute.String("product.name", req.ProductName),
-			),
-		)
-
+		// otelsql creates the "SELECT" span, scan included
 		var unitPrice float64
-		err := db.QueryRowContext(dbCtx, "SELECT unit_price FROM pricing WHERE product_name = ?", req.ProductName).Scan(&unitPrice)
-		dbSpan.End()
+		err := db.QueryRowContext(ctx, "SELECT unit_price FROM pricing WHERE product_name = ?", req.ProductName).Scan(&unitPrice)
 
 		if err != nil {
 			log.Printf("Database error: %v - trace_id: %s", err, traceID)
@@ -231,16 +251,8 @@ func main() {
 
 		log.Printf("Fetching all pricing - trace_id: %s", traceID)
 
-		dbCtx, dbSpan := tracer.Start(ctx, "db_select_all_pricing",
-			trace.WithAttributes(
-				attribute.String("db.operation", "select"),
-				attribute.String("db.table", "pricing"),
-			),
-		)
-
-		rows, err := db.QueryContext(dbCtx, "SELECT * FROM pricing")
-		dbSpan.End()
-
+		// otelsql's "SELECT" span lasts until rows is closed
+		rows, err := db.QueryContext(ctx, "SELECT * FROM pricing")
 		if err != nil {
 			log.Printf("Database error: %v - trace_id: %s", err, traceID)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -274,6 +286,8 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 	})
 
+	r.GET("/debug/propagation", gin.WrapH(propagation))
+
 	r.GET("/error", func(c *gin.Context) {
 		ctx := c.Request.Context()
 		span := trace.SpanFromContext(ctx)
@@ -300,18 +314,11 @@ func main() {
 
 		log.Printf("ERROR: Intentional pricing error for %s (quantity: %d) - trace_id: %s", req.ProductName, req.Quantity, traceID)
 
-		// Simulate pricing calculation but return error
-		dbCtx, dbSpan := tracer.Start(ctx, "db_select_pricing_error",
-			trace.WithAttributes(
-				attribute.String("db.operation", "select"),
-				attribute.String("db.table", "pricing"),
-				attribute.String("product.name", req.ProductName),
-			),
-		)
+		span.SetAttributes(attribute.String("product.name", req.ProductName))
 
+		// Simulate pricing calculation but return error
 		var unitPrice float64
-		err := db.QueryRowContext(dbCtx, "SELECT unit_price FROM pricing WHERE product_name = ?", req.ProductName).Scan(&unitPrice)
-		dbSpan.End()
+		err := db.QueryRowContext(ctx, "SELECT unit_price FROM pricing WHERE product_name = ?", req.ProductName).Scan(&unitPrice)
 
 		if err != nil {
 			log.Printf("ERROR: Database error: %v - trace_id: %s", err, traceID)
@@ -336,7 +343,7 @@ func main() {
 	// Start server
 	srv := &http.Server{
 		Addr:    ":8080",
-		Handler: r,
+		Handler: propagation.Handler(r),
 	}
 
 	go func() {
@@ -0,0 +1,161 @@
+// Package ecs detects the resource attributes of a container running on
+// Amazon ECS (EC2 or Fargate) from the task metadata endpoint.
+package ecs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// The ECS agent injects the metadata endpoint into every container; V4 is
+// available on Fargate 1.4+ and agent 1.39+, V3 on older platforms.
+const (
+	envMetadataV4 = "ECS_CONTAINER_METADATA_URI_V4"
+	envMetadataV3 = "ECS_CONTAINER_METADATA_URI"
+)
+
+// Detector is a resource.Detector reading the container and task metadata
+// of the ECS task it runs in. Outside of ECS it detects nothing. When the
+// metadata endpoint fails, the error is logged and the resource has the
+// attributes read so far, so that the service still starts.
+type Detector struct {
+	client *http.Client
+	logger *slog.Logger
+}
+
+var _ resource.Detector = (*Detector)(nil)
+
+// NewDetector returns a Detector.
+func NewDetector() *Detector {
+	return &Detector{client: &http.Client{Timeout: 5 * time.Second}, logger: slog.Default()}
+}
+
+// containerMetadata is the subset of GET ${ECS_CONTAINER_METADATA_URI_V4}
+// used for the resource.
+type containerMetadata struct {
+	DockerID     string `json:"DockerId"`
+	Name         string `json:"Name"`
+	Image        string `json:"Image"`
+	ContainerARN string `json:"ContainerARN"`
+}
+
+// taskMetadata is the subset of GET ${ECS_CONTAINER_METADATA_URI_V4}/task.
+// Cluster is an ARN on Fargate and may be a plain name on EC2.
+type taskMetadata struct {
+	Cluster          string `json:"Cluster"`
+	TaskARN          string `json:"TaskARN"`
+	Family           string `json:"Family"`
+	Revision         string `json:"Revision"`
+	LaunchType       string `json:"LaunchType"`
+	AvailabilityZone string `json:"AvailabilityZone"`
+}
+
+func (d *Detector) Detect(ctx context.Context) (*resource.Resource, error) {
+	uri := os.Getenv(envMetadataV4)
+	if uri == "" {
+		uri = os.Getenv(envMetadataV3)
+	}
+	if uri == "" {
+		return resource.Empty(), nil
+	}
+
+	var container containerMetadata
+	if err := d.get(ctx, uri, &container); err != nil {
+		d.logger.WarnContext(ctx, fmt.Sprintf("Detecting a partial ECS resource: %s", err))
+	}
+	var task taskMetadata
+	if err := d.get(ctx, uri+"/task", &task); err != nil {
+		d.logger.WarnContext(ctx, fmt.Sprintf("Detecting a partial ECS resource: %s", err))
+	}
+
+	attrs := []attribute.KeyValue{semconv.CloudProviderAWS, semconv.CloudPlatformAWSECS}
+	add := func(kv func(string) attribute.KeyValue, v string) {
+		if v != "" {
+			attrs = append(attrs, kv(v))
+		}
+	}
+
+	// arn:aws:ecs:<region>:<account>:task/<cluster>/<task id>
+	arn := strings.SplitN(task.TaskARN, ":", 6)
+	var region, account, taskID string
+	if len(arn) == 6 {
+		region, account = arn[3], arn[4]
+		taskID = arn[5][strings.LastIndex(arn[5], "/")+1:]
+	}
+	add(semconv.CloudRegion, region)
+	add(semconv.CloudAccountID, account)
+	add(semconv.CloudAvailabilityZone, task.AvailabilityZone)
+
+	add(semconv.AWSECSClusterARN, clusterARN(task.Cluster, arn))
+	add(semconv.AWSECSTaskARN, task.TaskARN)
+	add(semconv.AWSECSTaskID, taskID)
+	add(semconv.AWSECSTaskFamily, task.Family)
+	add(semconv.AWSECSTaskRevision, task.Revision)
+	add(semconv.AWSECSContainerARN, container.ContainerARN)
+	switch strings.ToUpper(task.LaunchType) {
+	case "EC2":
+		attrs = append(attrs, semconv.AWSECSLaunchtypeEC2)
+	case "FARGATE":
+		attrs = append(attrs, semconv.AWSECSLaunchtypeFargate)
+	}
+
+	add(semconv.ContainerName, container.Name)
+	add(semconv.ContainerID, container.DockerID)
+	name, tag := splitImage(container.Image)
+	add(semconv.ContainerImageName, name)
+	if tag != "" {
+		attrs = append(attrs, semconv.ContainerImageTags(tag))
+	}
+
+	return resource.NewWithAttributes(semconv.SchemaURL, attrs...), nil
+}
+
+func (d *Detector) get(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to read ECS metadata: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to read ECS metadata from %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode ECS metadata from %s: %w", url, err)
+	}
+	return nil
+}
+
+// clusterARN returns cluster as an ARN, building it from the task ARN's
+// prefix when the metadata only has the cluster name.
+func clusterARN(cluster string, taskARN []string) string {
+	if cluster == "" || strings.HasPrefix(cluster, "arn:") || len(taskARN) != 6 {
+		return cluster
+	}
+	return strings.Join(taskARN[:5], ":") + ":cluster/" + cluster
+}
+
+// splitImage splits "registry:port/repo:tag@digest" into the image name and
+// tag; the digest is dropped.
+func splitImage(image string) (name, tag string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, ""
+}
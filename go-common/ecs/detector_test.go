@@ -0,0 +1,173 @@
+package ecs
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// metadataServer stands in for the ECS agent's task metadata endpoint and
+// points ECS_CONTAINER_METADATA_URI_V4 at it. The unavailable paths answer
+// 503.
+func metadataServer(t *testing.T, cluster string, unavailable ...string) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v4/abc", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"DockerId": "abc-123",
+			"Name": "go-service",
+			"Image": "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/go-service:1.2.0",
+			"ContainerARN": "arn:aws:ecs:ap-northeast-1:123456789012:container/demo/0123/abc"
+		}`))
+	})
+	mux.HandleFunc("/v4/abc/task", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"Cluster": "` + cluster + `",
+			"TaskARN": "arn:aws:ecs:ap-northeast-1:123456789012:task/demo/0123",
+			"Family": "otel-demo-app",
+			"Revision": "7",
+			"LaunchType": "FARGATE",
+			"AvailabilityZone": "ap-northeast-1a"
+		}`))
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, path := range unavailable {
+			if r.URL.Path == path {
+				http.Error(w, "agent unavailable", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv(envMetadataV4, srv.URL+"/v4/abc")
+}
+
+func TestDetect(t *testing.T) {
+	for _, cluster := range []string{
+		"arn:aws:ecs:ap-northeast-1:123456789012:cluster/demo",
+		"demo", // EC2 launch type may report the name only
+	} {
+		metadataServer(t, cluster)
+
+		res, err := NewDetector().Detect(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[attribute.Key]string{
+			"cloud.provider":          "aws",
+			"cloud.platform":          "aws_ecs",
+			"cloud.region":            "ap-northeast-1",
+			"cloud.account.id":        "123456789012",
+			"cloud.availability_zone": "ap-northeast-1a",
+			"aws.ecs.cluster.arn":     "arn:aws:ecs:ap-northeast-1:123456789012:cluster/demo",
+			"aws.ecs.task.arn":        "arn:aws:ecs:ap-northeast-1:123456789012:task/demo/0123",
+			"aws.ecs.task.id":         "0123",
+			"aws.ecs.task.family":     "otel-demo-app",
+			"aws.ecs.task.revision":   "7",
+			"aws.ecs.container.arn":   "arn:aws:ecs:ap-northeast-1:123456789012:container/demo/0123/abc",
+			"aws.ecs.launchtype":      "fargate",
+			"container.name":          "go-service",
+			"container.id":            "abc-123",
+			"container.image.name":    "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/go-service",
+		}
+		set := res.Set()
+		for k, v := range want {
+			if got, ok := set.Value(k); !ok || got.Emit() != v {
+				t.Errorf("cluster %q: %s = %q, want %q", cluster, k, got.Emit(), v)
+			}
+		}
+		if got, _ := set.Value("container.image.tags"); got.Emit() != `["1.2.0"]` {
+			t.Errorf("container.image.tags = %s", got.Emit())
+		}
+	}
+}
+
+func TestDetectOutsideECS(t *testing.T) {
+	t.Setenv(envMetadataV4, "")
+	t.Setenv(envMetadataV3, "")
+
+	res, err := NewDetector().Detect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Len() != 0 {
+		t.Errorf("got %v, want an empty resource", res)
+	}
+}
+
+func TestDetectEndpointError(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		unavailable []string
+		want        map[attribute.Key]string
+		warnings    int
+	}{
+		{
+			name:        "task metadata",
+			unavailable: []string{"/v4/abc/task"},
+			want: map[attribute.Key]string{
+				"cloud.provider":        "aws",
+				"cloud.platform":        "aws_ecs",
+				"aws.ecs.container.arn": "arn:aws:ecs:ap-northeast-1:123456789012:container/demo/0123/abc",
+				"container.name":        "go-service",
+				"container.id":          "abc-123",
+				"container.image.name":  "123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/go-service",
+				"container.image.tags":  `["1.2.0"]`,
+			},
+			warnings: 1,
+		},
+		{
+			name:        "every endpoint",
+			unavailable: []string{"/v4/abc", "/v4/abc/task"},
+			want: map[attribute.Key]string{
+				"cloud.provider": "aws",
+				"cloud.platform": "aws_ecs",
+			},
+			warnings: 2,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			metadataServer(t, "demo", tt.unavailable...)
+			var logs bytes.Buffer
+			d := NewDetector()
+			d.logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+			res, err := d.Detect(context.Background())
+			if err != nil {
+				t.Fatalf("want a partial resource, got %v", err)
+			}
+			got := map[attribute.Key]string{}
+			for _, kv := range res.Attributes() {
+				got[kv.Key] = kv.Value.Emit()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resource =\n%v\nwant\n%v", got, tt.want)
+			}
+			if n := strings.Count(logs.String(), "level=WARN"); n != tt.warnings || !strings.Contains(logs.String(), "503 Service Unavailable") {
+				t.Errorf("logged %d warnings, want %d with the status:\n%s", n, tt.warnings, logs.String())
+			}
+		})
+	}
+}
+
+func TestSplitImage(t *testing.T) {
+	for _, tt := range []struct{ image, name, tag string }{
+		{"go-service", "go-service", ""},
+		{"go-service:latest", "go-service", "latest"},
+		{"localhost:5000/go-service", "localhost:5000/go-service", ""},
+		{"localhost:5000/go-service:1.0@sha256:abcd", "localhost:5000/go-service", "1.0"},
+		{"go-service@sha256:abcd", "go-service", ""},
+	} {
+		if name, tag := splitImage(tt.image); name != tt.name || tag != tt.tag {
+			t.Errorf("splitImage(%q) = %q, %q; want %q, %q", tt.image, name, tag, tt.name, tt.tag)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Package headerprop carries trace headers from an incoming request to the
+// outgoing requests made while handling it. Services without a tracing SDK
+// behind a tracing proxy such as Envoy need this: the proxy starts the
+// server span, but only the application knows which outgoing request
+// belongs to which incoming one, so without the copy the trace breaks at
+// the next hop.
+//
+// A Propagator's middleware (Handler for net/http, Gin for gin) stores the
+// configured headers of the incoming request in its context, and Transport
+// adds them to every request sent with that context:
+//
+//	p, _ := headerprop.New(headerprop.Config{Deny: []string{"x-request-id"}})
+//	r.Use(p.Gin())
+//	client := &http.Client{Transport: &headerprop.Transport{}}
+//	req, _ := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, url, body)
+//	client.Do(req) // carries traceparent, b3, x-b3-*, ... of the incoming request
+package headerprop
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "github.com/nutslove/otel-instrumentation-demo/go-common/headerprop"
+
+// DefaultHeaders are the headers propagated when Config.Allow is empty:
+// W3C Trace Context and Baggage, B3 in its single and multi-header forms,
+// the OpenTracing headers of Envoy's ot tracers and Envoy's request ID.
+var DefaultHeaders = []string{
+	"traceparent",
+	"tracestate",
+	"baggage",
+	"b3",
+	"x-b3-*",
+	"x-ot-*",
+	"x-request-id",
+}
+
+// Config selects the headers to propagate. Names are case-insensitive; a
+// trailing "*" matches every header starting with the rest of the name, so
+// "x-b3-*" covers x-b3-traceid, x-b3-spanid, x-b3-sampled and so on.
+type Config struct {
+	// Allow lists the headers to propagate (DefaultHeaders when empty).
+	Allow []string
+	// Deny lists headers never to propagate, even when Allow matches them.
+	Deny []string
+
+	// Sanitize validates the headers before they are stored, so that a
+	// malformed or oversized value from a client does not travel down the
+	// whole chain:
+	//
+	//   - traceparent must follow W3C Trace Context (version, non-zero
+	//     IDs, flags); otherwise it is dropped along with tracestate
+	//   - tracestate keeps its well-formed members, within 32 members and
+	//     512 characters
+	//   - b3 and X-B3-* IDs are lower-cased, malformed ones dropped
+	//   - any other value over 8192 bytes is dropped
+	//
+	// Every change is counted in headerprop.invalid{header, reason,
+	// action} and, with Logger set, logged as a warning.
+	Sanitize bool
+	Logger   *slog.Logger
+	// MeterProvider records headerprop.invalid (the global one when nil).
+	MeterProvider metric.MeterProvider
+}
+
+// Propagator extracts the configured headers from incoming requests.
+type Propagator struct {
+	allow, deny []pattern
+	sanitizer   *sanitizer
+}
+
+// pattern is a lower-case header name, or a prefix when prefix is set.
+type pattern struct {
+	name   string
+	prefix bool
+}
+
+// New returns a Propagator for cfg.
+func New(cfg Config) (*Propagator, error) {
+	allow := cfg.Allow
+	if len(allow) == 0 {
+		allow = DefaultHeaders
+	}
+	p := &Propagator{}
+	var err error
+	if p.allow, err = parsePatterns(allow); err != nil {
+		return nil, err
+	}
+	if p.deny, err = parsePatterns(cfg.Deny); err != nil {
+		return nil, err
+	}
+	if cfg.Sanitize {
+		mp := cfg.MeterProvider
+		if mp == nil {
+			mp = otel.GetMeterProvider()
+		}
+		if p.sanitizer, err = newSanitizer(cfg.Logger, mp); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func parsePatterns(names []string) ([]pattern, error) {
+	patterns := make([]pattern, 0, len(names))
+	for _, n := range names {
+		n = strings.ToLower(strings.TrimSpace(n))
+		name, prefix := strings.CutSuffix(n, "*")
+		if n == "" || strings.Contains(name, "*") {
+			return nil, fmt.Errorf("headerprop: invalid header pattern %q", n)
+		}
+		patterns = append(patterns, pattern{name: name, prefix: prefix})
+	}
+	return patterns, nil
+}
+
+func (p pattern) match(name string) bool {
+	if p.prefix {
+		return strings.HasPrefix(name, p.name)
+	}
+	return name == p.name
+}
+
+// Match reports whether the header name is propagated.
+func (p *Propagator) Match(name string) bool {
+	name = strings.ToLower(name)
+	for _, d := range p.deny {
+		if d.match(name) {
+			return false
+		}
+	}
+	for _, a := range p.allow {
+		if a.match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Extract returns the propagated headers of h, sanitized if configured, or
+// nil if there are none. ctx is the incoming request's, for the logs.
+func (p *Propagator) Extract(ctx context.Context, h http.Header) http.Header {
+	var out http.Header
+	for name, values := range h {
+		if len(values) == 0 || !p.Match(name) {
+			continue
+		}
+		if out == nil {
+			out = make(http.Header)
+		}
+		out[name] = append([]string(nil), values...)
+	}
+	if out != nil && p.sanitizer != nil {
+		p.sanitizer.sanitize(ctx, out)
+		if len(out) == 0 {
+			return nil
+		}
+	}
+	return out
+}
+
+// Handler stores the propagated headers of each request in its context
+// before calling next.
+func (p *Propagator) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h := p.Extract(r.Context(), r.Header); h != nil {
+			r = r.WithContext(NewContext(r.Context(), h))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Gin is Handler as gin middleware.
+func (p *Propagator) Gin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h := p.Extract(c.Request.Context(), c.Request.Header); h != nil {
+			c.Request = c.Request.WithContext(NewContext(c.Request.Context(), h))
+		}
+		c.Next()
+	}
+}
+
+type headersKey struct{}
+
+// NewContext returns a copy of ctx carrying the headers h to propagate.
+func NewContext(ctx context.Context, h http.Header) context.Context {
+	return context.WithValue(ctx, headersKey{}, h)
+}
+
+// FromContext returns the headers stored in ctx, or nil. The result must
+// not be modified.
+func FromContext(ctx context.Context) http.Header {
+	h, _ := ctx.Value(headersKey{}).(http.Header)
+	return h
+}
@@ -0,0 +1,128 @@
+package headerprop
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func TestParsePatterns(t *testing.T) {
+	got, err := parsePatterns([]string{" Traceparent ", "X-B3-*", "*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []pattern{
+		{name: "traceparent"},
+		{name: "x-b3-", prefix: true},
+		{name: "", prefix: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parsePatterns = %v, want %v", got, want)
+	}
+
+	for _, name := range []string{"", "  ", "x-*-id", "x-b3-**"} {
+		if _, err := parsePatterns([]string{name}); err == nil {
+			t.Errorf("parsePatterns(%q): want an error", name)
+		}
+	}
+	if _, err := New(Config{Deny: []string{"x-*-id"}}); err == nil {
+		t.Error("New with an invalid deny pattern: want an error")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		allow, deny []string
+		header      string
+		want        bool
+	}{
+		{name: "default", header: "traceparent", want: true},
+		{name: "default prefix", header: "x-ot-span-context", want: true},
+		{name: "default, not listed", header: "authorization", want: false},
+		{name: "exact", allow: []string{"traceparent"}, header: "traceparent", want: true},
+		{name: "exact, other header", allow: []string{"traceparent"}, header: "tracestate", want: false},
+		{name: "prefix", allow: []string{"x-b3-*"}, header: "x-b3-traceid", want: true},
+		{name: "prefix, name itself", allow: []string{"x-b3-*"}, header: "x-b3", want: false},
+		{name: "case-insensitive header", allow: []string{"x-b3-*"}, header: "X-B3-TraceId", want: true},
+		{name: "case-insensitive pattern", allow: []string{"X-Request-ID"}, header: "x-request-id", want: true},
+		{name: "deny over allow", allow: []string{"x-b3-*"}, deny: []string{"x-b3-flags"}, header: "X-B3-Flags", want: false},
+		{name: "deny prefix over exact allow", allow: []string{"x-ot-span-context"}, deny: []string{"x-ot-*"}, header: "x-ot-span-context", want: false},
+		{name: "deny over default", deny: []string{"x-request-id"}, header: "X-Request-Id", want: false},
+		{name: "deny leaves the rest", deny: []string{"x-request-id"}, header: "b3", want: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := New(Config{Allow: tt.allow, Deny: tt.deny})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := p.Match(tt.header); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	valid := "00-" + traceID + "-" + spanID + "-01"
+	p, err := New(Config{Deny: []string{"x-request-id"}, Sanitize: true, MeterProvider: noop.NewMeterProvider()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := p.Extract(t.Context(), header(
+		"traceparent", valid,
+		"X-B3-TraceId", traceID,
+		"X-B3-SpanId", spanID,
+		"X-Request-Id", "abc",
+		"Content-Type", "application/json",
+	))
+	want := header("traceparent", valid, "X-B3-TraceId", traceID, "X-B3-SpanId", spanID)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Extract = %v, want %v", got, want)
+	}
+
+	// Nothing left once the sanitizer drops the only trace header
+	if got := p.Extract(t.Context(), header("traceparent", "garbage")); got != nil {
+		t.Errorf("Extract of an invalid traceparent = %v, want nil", got)
+	}
+	if got := p.Extract(t.Context(), header("Content-Type", "application/json")); got != nil {
+		t.Errorf("Extract without trace headers = %v, want nil", got)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	p, err := New(Config{Allow: []string{"traceparent"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := "00-" + traceID + "-" + spanID + "-01"
+	want := header("traceparent", valid)
+
+	var got http.Header
+	h := p.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromContext(r.Context())
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("traceparent", valid)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Handler stored %v, want %v", got, want)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(p.Gin())
+	got = nil
+	r.GET("/", func(c *gin.Context) {
+		got = FromContext(c.Request.Context())
+	})
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Gin stored %v, want %v", got, want)
+	}
+}
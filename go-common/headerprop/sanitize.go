@@ -0,0 +1,372 @@
+package headerprop
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Limits from the W3C Trace Context and Baggage specifications.
+const (
+	traceparentLength     = 55
+	tracestateMaxMembers  = 32
+	tracestateMaxLength   = 512
+	tracestateLongMember  = 128
+	tracestateMaxKeyLen   = 256
+	tracestateMaxValueLen = 256
+	// maxValueLength bounds every other propagated header, at the size
+	// Baggage allows.
+	maxValueLength = 8192
+)
+
+// Actions taken on an invalid header.
+const (
+	ActionDropped    = "dropped"
+	ActionTruncated  = "truncated"
+	ActionNormalized = "normalized"
+)
+
+// Invalid describes a header that sanitizing dropped, truncated or
+// rewrote.
+type Invalid struct {
+	// Header is the lower-case header name.
+	Header string
+	// Reason says what was wrong, e.g. "zero_trace_id" or "too_many_members".
+	Reason string
+	// Action is ActionDropped, ActionTruncated or ActionNormalized.
+	Action string
+	// Length is the length of the value as received. The value itself is
+	// client input and is neither kept nor logged.
+	Length int
+}
+
+// sanitizer validates the trace headers in an extracted header set and
+// reports what it changed as log records and the headerprop.invalid
+// counter.
+type sanitizer struct {
+	logger  *slog.Logger
+	invalid metric.Int64Counter
+}
+
+func newSanitizer(logger *slog.Logger, mp metric.MeterProvider) (*sanitizer, error) {
+	invalid, err := mp.Meter(instrumentationName).Int64Counter("headerprop.invalid",
+		metric.WithDescription("Number of incoming trace headers dropped, truncated or normalized before propagation."),
+		metric.WithUnit("{header}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &sanitizer{logger: logger, invalid: invalid}, nil
+}
+
+func (s *sanitizer) report(ctx context.Context, inv Invalid) {
+	s.invalid.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("header", inv.Header),
+		attribute.String("reason", inv.Reason),
+		attribute.String("action", inv.Action),
+	))
+	if s.logger != nil {
+		s.logger.WarnContext(ctx, fmt.Sprintf("Invalid %s header %s (%s)", inv.Header, inv.Action, inv.Reason),
+			slog.String("header", inv.Header),
+			slog.String("reason", inv.Reason),
+			slog.String("action", inv.Action),
+			slog.Int("value.length", inv.Length),
+		)
+	}
+}
+
+// sanitize fixes h in place.
+func (s *sanitizer) sanitize(ctx context.Context, h http.Header) {
+	s.traceparent(ctx, h)
+	s.tracestate(ctx, h)
+	s.b3(ctx, h)
+	s.multiB3(ctx, h)
+
+	for name, values := range h {
+		for _, v := range values {
+			if len(v) > maxValueLength {
+				s.report(ctx, Invalid{Header: strings.ToLower(name), Reason: "too_long", Action: ActionDropped, Length: len(v)})
+				delete(h, name)
+				break
+			}
+		}
+	}
+}
+
+// traceparent validates "version-traceid-parentid-flags". A newer version
+// is propagated as version 00, as the specification asks; tracestate goes
+// along with an invalid traceparent.
+func (s *sanitizer) traceparent(ctx context.Context, h http.Header) {
+	values, ok := h["Traceparent"]
+	if !ok {
+		return
+	}
+	drop := func(reason, v string) {
+		s.report(ctx, Invalid{Header: "traceparent", Reason: reason, Action: ActionDropped, Length: len(v)})
+		delete(h, "Traceparent")
+		if ts, ok := h["Tracestate"]; ok {
+			s.report(ctx, Invalid{Header: "tracestate", Reason: "invalid_traceparent", Action: ActionDropped, Length: len(strings.Join(ts, ","))})
+			delete(h, "Tracestate")
+		}
+	}
+	if len(values) != 1 {
+		drop("multiple_values", strings.Join(values, ","))
+		return
+	}
+
+	v := values[0]
+	version := ""
+	if len(v) >= 2 {
+		version = v[:2]
+	}
+	switch {
+	case len(v) < traceparentLength || !isHex(version):
+		drop("malformed", v)
+		return
+	case version == "ff":
+		drop("invalid_version", v)
+		return
+	case version == "00" && len(v) != traceparentLength,
+		len(v) > traceparentLength && v[traceparentLength] != '-',
+		v[2] != '-' || v[35] != '-' || v[52] != '-':
+		drop("malformed", v)
+		return
+	}
+	traceID, parentID, flags := v[3:35], v[36:52], v[53:55]
+	switch {
+	case !isHex(traceID) || !isHex(parentID):
+		drop("malformed", v)
+	case isZero(traceID):
+		drop("zero_trace_id", v)
+	case isZero(parentID):
+		drop("zero_parent_id", v)
+	case !isHex(flags):
+		drop("invalid_flags", v)
+	case version != "00":
+		h["Traceparent"] = []string{"00-" + traceID + "-" + parentID + "-" + flags}
+		s.report(ctx, Invalid{Header: "traceparent", Reason: "future_version", Action: ActionNormalized, Length: len(v)})
+	}
+}
+
+// tracestate keeps the well-formed list members, at most 32 of them in at
+// most 512 characters. Longer lists lose their members over 128 characters
+// first, then members from the end, as the specification suggests.
+func (s *sanitizer) tracestate(ctx context.Context, h http.Header) {
+	values, ok := h["Tracestate"]
+	if !ok {
+		return
+	}
+	raw := strings.Join(values, ",")
+
+	var members []string
+	keys := map[string]bool{}
+	reasons := map[string]bool{}
+	for _, m := range strings.Split(raw, ",") {
+		m = strings.Trim(m, " \t")
+		if m == "" {
+			continue
+		}
+		key, value, found := strings.Cut(m, "=")
+		switch {
+		case !found || !validKey(key) || !validValue(value):
+			reasons["invalid_member"] = true
+		case keys[key]:
+			reasons["duplicate_key"] = true
+		default:
+			keys[key] = true
+			members = append(members, m)
+		}
+	}
+	if len(members) > tracestateMaxMembers {
+		members = members[:tracestateMaxMembers]
+		reasons["too_many_members"] = true
+	}
+	if length(members) > tracestateMaxLength {
+		reasons["too_long"] = true
+		for i := len(members) - 1; i >= 0 && length(members) > tracestateMaxLength; i-- {
+			if len(members[i]) > tracestateLongMember {
+				members = append(members[:i], members[i+1:]...)
+			}
+		}
+		for length(members) > tracestateMaxLength {
+			members = members[:len(members)-1]
+		}
+	}
+
+	action := ActionTruncated
+	if len(members) == 0 {
+		action = ActionDropped
+		delete(h, "Tracestate")
+	} else {
+		h["Tracestate"] = []string{strings.Join(members, ",")}
+	}
+	for _, reason := range []string{"invalid_member", "duplicate_key", "too_many_members", "too_long"} {
+		if reasons[reason] {
+			s.report(ctx, Invalid{Header: "tracestate", Reason: reason, Action: action, Length: len(raw)})
+		}
+	}
+}
+
+// length is the length of members joined by commas.
+func length(members []string) int {
+	n := 0
+	for _, m := range members {
+		n += len(m) + 1
+	}
+	return max(n-1, 0)
+}
+
+// validKey accepts "key" and "tenant@system" keys.
+func validKey(key string) bool {
+	tenant, system, multi := strings.Cut(key, "@")
+	if !multi {
+		return len(key) <= tracestateMaxKeyLen && key != "" && isLowerAlpha(key[0]) && keyChars(key[1:])
+	}
+	return tenant != "" && len(tenant) <= 241 && (isLowerAlpha(tenant[0]) || isDigit(tenant[0])) && keyChars(tenant[1:]) &&
+		system != "" && len(system) <= 14 && isLowerAlpha(system[0]) && keyChars(system[1:])
+}
+
+func keyChars(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !isLowerAlpha(c) && !isDigit(c) && c != '_' && c != '-' && c != '*' && c != '/' {
+			return false
+		}
+	}
+	return true
+}
+
+// validValue accepts up to 256 printable ASCII characters other than ","
+// and "=", not ending in a space.
+func validValue(v string) bool {
+	if v == "" || len(v) > tracestateMaxValueLen || v[len(v)-1] == ' ' {
+		return false
+	}
+	for i := 0; i < len(v); i++ {
+		if c := v[i]; c < 0x20 || c > 0x7e || c == ',' || c == '=' {
+			return false
+		}
+	}
+	return true
+}
+
+// b3 validates the single header: "{traceid}-{spanid}[-{sampled}[-{parentspanid}]]"
+// or a bare sampling state. IDs are lower-cased.
+func (s *sanitizer) b3(ctx context.Context, h http.Header) {
+	values, ok := h["B3"]
+	if !ok {
+		return
+	}
+	if len(values) != 1 {
+		s.report(ctx, Invalid{Header: "b3", Reason: "multiple_values", Action: ActionDropped, Length: len(strings.Join(values, ","))})
+		delete(h, "B3")
+		return
+	}
+
+	v := values[0]
+	normalized := strings.ToLower(v)
+	parts := strings.Split(normalized, "-")
+	valid := false
+	switch len(parts) {
+	case 1:
+		valid = validSampled(parts[0])
+	case 2, 3, 4:
+		valid = validB3TraceID(parts[0]) && validB3SpanID(parts[1]) &&
+			(len(parts) < 3 || validSampled(parts[2])) &&
+			(len(parts) < 4 || validB3SpanID(parts[3]))
+	}
+	switch {
+	case !valid:
+		s.report(ctx, Invalid{Header: "b3", Reason: "malformed", Action: ActionDropped, Length: len(v)})
+		delete(h, "B3")
+	case normalized != v:
+		h["B3"] = []string{normalized}
+		s.report(ctx, Invalid{Header: "b3", Reason: "uppercase", Action: ActionNormalized, Length: len(v)})
+	}
+}
+
+// multiB3 validates the X-B3-* headers. A trace ID without span ID, or the
+// other way round, is dropped as incomplete.
+func (s *sanitizer) multiB3(ctx context.Context, h http.Header) {
+	check := func(name string, valid func(string) bool, normalize func(string) string) {
+		values, ok := h[name]
+		if !ok {
+			return
+		}
+		header := strings.ToLower(name)
+		if len(values) != 1 {
+			s.report(ctx, Invalid{Header: header, Reason: "multiple_values", Action: ActionDropped, Length: len(strings.Join(values, ","))})
+			delete(h, name)
+			return
+		}
+		v := values[0]
+		normalized := normalize(v)
+		switch {
+		case !valid(normalized):
+			s.report(ctx, Invalid{Header: header, Reason: "malformed", Action: ActionDropped, Length: len(v)})
+			delete(h, name)
+		case normalized != v:
+			h[name] = []string{normalized}
+			s.report(ctx, Invalid{Header: header, Reason: "non_canonical", Action: ActionNormalized, Length: len(v)})
+		}
+	}
+	check("X-B3-Traceid", validB3TraceID, strings.ToLower)
+	check("X-B3-Spanid", validB3SpanID, strings.ToLower)
+	check("X-B3-Parentspanid", validB3SpanID, strings.ToLower)
+	check("X-B3-Sampled", func(v string) bool { return v == "0" || v == "1" }, func(v string) string {
+		// Some old tracers send true/false
+		switch strings.ToLower(v) {
+		case "true":
+			return "1"
+		case "false":
+			return "0"
+		}
+		return v
+	})
+	check("X-B3-Flags", func(v string) bool { return v == "1" }, func(v string) string { return v })
+
+	_, hasTrace := h["X-B3-Traceid"]
+	_, hasSpan := h["X-B3-Spanid"]
+	if hasTrace != hasSpan {
+		for _, name := range []string{"X-B3-Traceid", "X-B3-Spanid", "X-B3-Parentspanid"} {
+			if values, ok := h[name]; ok {
+				s.report(ctx, Invalid{Header: strings.ToLower(name), Reason: "incomplete", Action: ActionDropped, Length: len(strings.Join(values, ","))})
+				delete(h, name)
+			}
+		}
+	}
+}
+
+func validB3TraceID(id string) bool {
+	return (len(id) == 16 || len(id) == 32) && isHex(id) && !isZero(id)
+}
+
+func validB3SpanID(id string) bool {
+	return len(id) == 16 && isHex(id) && !isZero(id)
+}
+
+func validSampled(v string) bool {
+	return v == "0" || v == "1" || v == "d"
+}
+
+// isHex reports whether s is lower-case hex.
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !isDigit(c) && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
+
+func isDigit(c byte) bool      { return c >= '0' && c <= '9' }
+func isLowerAlpha(c byte) bool { return c >= 'a' && c <= 'z' }
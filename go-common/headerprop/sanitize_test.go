@@ -0,0 +1,303 @@
+package headerprop
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+const (
+	traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	spanID  = "00f067aa0ba902b7"
+)
+
+// header builds an http.Header from name/value pairs, canonicalizing the
+// names as the server does.
+func header(kv ...string) http.Header {
+	h := http.Header{}
+	for i := 0; i < len(kv); i += 2 {
+		h.Add(kv[i], kv[i+1])
+	}
+	return h
+}
+
+// report is what the sanitizer logged for one invalid header.
+type report struct {
+	Header, Reason, Action string
+}
+
+// sanitizeHeaders runs the sanitizer over h and returns what it reported.
+func sanitizeHeaders(t *testing.T, h http.Header) []report {
+	t.Helper()
+	var buf bytes.Buffer
+	s, err := newSanitizer(slog.New(slog.NewJSONHandler(&buf, nil)), noop.NewMeterProvider())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.sanitize(context.Background(), h)
+
+	var reports []report
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var rec struct {
+			Header, Reason, Action string
+			Value                  *string `json:"value"`
+		}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Value != nil {
+			t.Errorf("log record has the raw value: %s", line)
+		}
+		reports = append(reports, report{rec.Header, rec.Reason, rec.Action})
+	}
+	return reports
+}
+
+type sanitizeTest struct {
+	name        string
+	in, want    http.Header
+	wantReports []report
+}
+
+func runSanitizeTests(t *testing.T, tests []sanitizeTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.in.Clone()
+			reports := sanitizeHeaders(t, got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("headers = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(reports, tt.wantReports) {
+				t.Errorf("reports = %v, want %v", reports, tt.wantReports)
+			}
+		})
+	}
+}
+
+func TestSanitizeTraceparent(t *testing.T) {
+	valid := "00-" + traceID + "-" + spanID + "-01"
+	dropped := func(reason string) []report {
+		return []report{
+			{"traceparent", reason, ActionDropped},
+			{"tracestate", "invalid_traceparent", ActionDropped},
+		}
+	}
+	runSanitizeTests(t, []sanitizeTest{
+		{
+			name: "valid",
+			in:   header("traceparent", valid, "tracestate", "rojo=1"),
+			want: header("traceparent", valid, "tracestate", "rojo=1"),
+		},
+		{
+			name:        "version ff",
+			in:          header("traceparent", "ff-"+traceID+"-"+spanID+"-01", "tracestate", "rojo=1"),
+			want:        header(),
+			wantReports: dropped("invalid_version"),
+		},
+		{
+			name:        "future version with trailing fields",
+			in:          header("traceparent", "cc-"+traceID+"-"+spanID+"-01-what-the-future-holds", "tracestate", "rojo=1"),
+			want:        header("traceparent", valid, "tracestate", "rojo=1"),
+			wantReports: []report{{"traceparent", "future_version", ActionNormalized}},
+		},
+		{
+			name:        "future version without separator",
+			in:          header("traceparent", "cc-"+traceID+"-"+spanID+"-01x", "tracestate", "rojo=1"),
+			want:        header(),
+			wantReports: dropped("malformed"),
+		},
+		{
+			name:        "version 00 with trailing fields",
+			in:          header("traceparent", valid+"-extra", "tracestate", "rojo=1"),
+			want:        header(),
+			wantReports: dropped("malformed"),
+		},
+		{
+			name:        "all-zero trace ID",
+			in:          header("traceparent", "00-"+strings.Repeat("0", 32)+"-"+spanID+"-01"),
+			want:        header(),
+			wantReports: []report{{"traceparent", "zero_trace_id", ActionDropped}},
+		},
+		{
+			name:        "all-zero parent ID",
+			in:          header("traceparent", "00-"+traceID+"-"+strings.Repeat("0", 16)+"-01"),
+			want:        header(),
+			wantReports: []report{{"traceparent", "zero_parent_id", ActionDropped}},
+		},
+		{
+			name:        "uppercase hex",
+			in:          header("traceparent", "00-"+strings.ToUpper(traceID)+"-"+spanID+"-01"),
+			want:        header(),
+			wantReports: []report{{"traceparent", "malformed", ActionDropped}},
+		},
+		{
+			name:        "bad flags",
+			in:          header("traceparent", "00-"+traceID+"-"+spanID+"-zz"),
+			want:        header(),
+			wantReports: []report{{"traceparent", "invalid_flags", ActionDropped}},
+		},
+		{
+			name:        "too short",
+			in:          header("traceparent", "00-"+traceID),
+			want:        header(),
+			wantReports: []report{{"traceparent", "malformed", ActionDropped}},
+		},
+		{
+			name:        "multiple values",
+			in:          header("traceparent", valid, "traceparent", valid),
+			want:        header(),
+			wantReports: []report{{"traceparent", "multiple_values", ActionDropped}},
+		},
+	})
+}
+
+func TestSanitizeTracestate(t *testing.T) {
+	var members []string
+	for i := range tracestateMaxMembers + 1 {
+		members = append(members, "k"+strconv.Itoa(i)+"=v")
+	}
+	long := func(key string) string { return key + "=" + strings.Repeat("x", 127) }
+
+	runSanitizeTests(t, []sanitizeTest{
+		{
+			name: "valid",
+			in:   header("tracestate", "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"),
+			want: header("tracestate", "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE"),
+		},
+		{
+			name: "multiple header values",
+			in:   header("tracestate", "rojo=1", "tracestate", "congo=2"),
+			want: header("tracestate", "rojo=1,congo=2"),
+		},
+		{
+			name:        "32-member limit",
+			in:          header("tracestate", strings.Join(members, ",")),
+			want:        header("tracestate", strings.Join(members[:tracestateMaxMembers], ",")),
+			wantReports: []report{{"tracestate", "too_many_members", ActionTruncated}},
+		},
+		{
+			name:        "key grammar",
+			in:          header("tracestate", "Rojo=1,1abc=2,tenant@sys=3,0tenant@sys=4,t@Sys=5,a/b*c_d-e=6,novalue,empty="),
+			want:        header("tracestate", "tenant@sys=3,0tenant@sys=4,a/b*c_d-e=6"),
+			wantReports: []report{{"tracestate", "invalid_member", ActionTruncated}},
+		},
+		{
+			name:        "duplicate keys",
+			in:          header("tracestate", "rojo=1,congo=2,rojo=3"),
+			want:        header("tracestate", "rojo=1,congo=2"),
+			wantReports: []report{{"tracestate", "duplicate_key", ActionTruncated}},
+		},
+		{
+			name:        "long members go first",
+			in:          header("tracestate", strings.Join([]string{long("l0"), "s=1", long("l1"), long("l2"), long("l3")}, ",")),
+			want:        header("tracestate", strings.Join([]string{long("l0"), "s=1", long("l1"), long("l2")}, ",")),
+			wantReports: []report{{"tracestate", "too_long", ActionTruncated}},
+		},
+		{
+			name:        "nothing valid",
+			in:          header("tracestate", "=1,Rojo=2"),
+			want:        header(),
+			wantReports: []report{{"tracestate", "invalid_member", ActionDropped}},
+		},
+	})
+}
+
+func TestSanitizeB3(t *testing.T) {
+	single := traceID + "-" + spanID + "-1-" + "05e3ac9a4f6e3b90"
+	runSanitizeTests(t, []sanitizeTest{
+		{
+			name: "single header",
+			in:   header("b3", single),
+			want: header("b3", single),
+		},
+		{
+			name: "single header, sampling state only",
+			in:   header("b3", "d"),
+			want: header("b3", "d"),
+		},
+		{
+			name:        "single header, uppercase",
+			in:          header("b3", strings.ToUpper(single)),
+			want:        header("b3", single),
+			wantReports: []report{{"b3", "uppercase", ActionNormalized}},
+		},
+		{
+			name:        "single header, malformed",
+			in:          header("b3", traceID+"-abc"),
+			want:        header(),
+			wantReports: []report{{"b3", "malformed", ActionDropped}},
+		},
+		{
+			name:        "single header, zero trace ID",
+			in:          header("b3", strings.Repeat("0", 32)+"-"+spanID),
+			want:        header(),
+			wantReports: []report{{"b3", "malformed", ActionDropped}},
+		},
+		{
+			name:        "single header, multiple values",
+			in:          header("b3", single, "b3", single),
+			want:        header(),
+			wantReports: []report{{"b3", "multiple_values", ActionDropped}},
+		},
+		{
+			name: "multi header",
+			in:   header("X-B3-TraceId", traceID[16:], "X-B3-SpanId", spanID, "X-B3-Sampled", "1", "X-B3-Flags", "1"),
+			want: header("X-B3-TraceId", traceID[16:], "X-B3-SpanId", spanID, "X-B3-Sampled", "1", "X-B3-Flags", "1"),
+		},
+		{
+			name: "multi header, repaired",
+			in:   header("X-B3-TraceId", strings.ToUpper(traceID), "X-B3-SpanId", spanID, "X-B3-Sampled", "true"),
+			want: header("X-B3-TraceId", traceID, "X-B3-SpanId", spanID, "X-B3-Sampled", "1"),
+			wantReports: []report{
+				{"x-b3-traceid", "non_canonical", ActionNormalized},
+				{"x-b3-sampled", "non_canonical", ActionNormalized},
+			},
+		},
+		{
+			name: "multi header, malformed",
+			in:   header("X-B3-TraceId", traceID, "X-B3-SpanId", spanID, "X-B3-Sampled", "yes", "X-B3-Flags", "2"),
+			want: header("X-B3-TraceId", traceID, "X-B3-SpanId", spanID),
+			wantReports: []report{
+				{"x-b3-sampled", "malformed", ActionDropped},
+				{"x-b3-flags", "malformed", ActionDropped},
+			},
+		},
+		{
+			name: "multi header, span ID dropped",
+			in:   header("X-B3-TraceId", traceID, "X-B3-SpanId", "zz", "X-B3-Sampled", "1"),
+			want: header("X-B3-Sampled", "1"),
+			wantReports: []report{
+				{"x-b3-spanid", "malformed", ActionDropped},
+				{"x-b3-traceid", "incomplete", ActionDropped},
+			},
+		},
+	})
+}
+
+func TestSanitizeTooLong(t *testing.T) {
+	runSanitizeTests(t, []sanitizeTest{
+		{
+			name:        "dropped",
+			in:          header("X-Request-Id", strings.Repeat("a", maxValueLength+1)),
+			want:        header(),
+			wantReports: []report{{"x-request-id", "too_long", ActionDropped}},
+		},
+		{
+			name: "at the limit",
+			in:   header("X-Request-Id", strings.Repeat("a", maxValueLength)),
+			want: header("X-Request-Id", strings.Repeat("a", maxValueLength)),
+		},
+	})
+}
@@ -0,0 +1,48 @@
+package headerprop
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Transport is an http.RoundTripper adding the headers stored in the
+// request's context (see NewContext) to the request. Headers the request
+// already has are left as they are.
+type Transport struct {
+	// Base sends the requests (http.DefaultTransport when nil).
+	Base http.RoundTripper
+	// Logger, when set, logs the names of the headers added at Info level.
+	// Their values are not logged.
+	Logger *slog.Logger
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	h := FromContext(req.Context())
+	if len(h) == 0 {
+		return base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the caller's request
+	out := req.Clone(req.Context())
+	var added []string
+	for name, values := range h {
+		if _, set := out.Header[name]; set {
+			continue
+		}
+		out.Header[name] = values
+		added = append(added, name)
+	}
+	if t.Logger != nil && len(added) > 0 {
+		sort.Strings(added)
+		t.Logger.InfoContext(req.Context(), fmt.Sprintf("Propagating headers: %s", strings.Join(added, ", ")))
+	}
+	return base.RoundTrip(out)
+}
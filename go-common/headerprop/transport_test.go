@@ -0,0 +1,69 @@
+package headerprop
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// roundTripper records the request it is asked to send.
+type roundTripper struct {
+	req *http.Request
+}
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.req = req
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func TestTransport(t *testing.T) {
+	incoming := "00-" + traceID + "-" + spanID + "-01"
+	outgoing := "00-" + traceID + "-b7ad6b7169203331-01"
+
+	for _, tt := range []struct {
+		name         string
+		stored, want http.Header
+		set          []string
+	}{
+		{
+			name:   "added",
+			stored: header("traceparent", incoming, "X-B3-TraceId", traceID),
+			want:   header("traceparent", incoming, "X-B3-TraceId", traceID, "Content-Type", "application/json"),
+		},
+		{
+			name:   "existing header kept",
+			stored: header("traceparent", incoming, "X-B3-TraceId", traceID),
+			set:    []string{"traceparent", outgoing},
+			want:   header("traceparent", outgoing, "X-B3-TraceId", traceID, "Content-Type", "application/json"),
+		},
+		{
+			name: "nothing stored",
+			want: header("Content-Type", "application/json"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := t.Context()
+			if tt.stored != nil {
+				ctx = NewContext(ctx, tt.stored)
+			}
+			req := httptest.NewRequestWithContext(ctx, http.MethodPost, "http://java-service/notify", nil)
+			req.Header.Set("Content-Type", "application/json")
+			for i := 0; i < len(tt.set); i += 2 {
+				req.Header.Set(tt.set[i], tt.set[i+1])
+			}
+			before := req.Header.Clone()
+
+			base := &roundTripper{}
+			if _, err := (&Transport{Base: base}).RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(base.req.Header, tt.want) {
+				t.Errorf("sent headers = %v, want %v", base.req.Header, tt.want)
+			}
+			if !reflect.DeepEqual(req.Header, before) {
+				t.Errorf("caller's request modified: %v, was %v", req.Header, before)
+			}
+		})
+	}
+}
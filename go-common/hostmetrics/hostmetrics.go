@@ -0,0 +1,304 @@
+// Package hostmetrics records process and host metrics. It is a small
+// stand-in for go.opentelemetry.io/contrib/instrumentation/host, which
+// depends on gopsutil: the services run in Linux containers, so the process
+// and system values come straight from /proc. Elsewhere only the values that
+// do not need /proc (CPU time and count, uptime) are reported.
+package hostmetrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "github.com/nutslove/otel-instrumentation-demo/go-common/hostmetrics"
+
+// userHZ is the unit of the CPU times in /proc/stat (USER_HZ, 100 on every
+// Linux architecture the services are built for).
+const userHZ = 100
+
+var startTime = time.Now()
+
+// The /proc files read at every collection.
+const (
+	statusFile  = "/proc/self/status"
+	fdDir       = "/proc/self/fd"
+	statFile    = "/proc/stat"
+	meminfoFile = "/proc/meminfo"
+	netDevFile  = "/proc/net/dev"
+)
+
+// Start registers process and host instruments on mp (the global
+// MeterProvider when nil), observed at every collection:
+//
+//   - process.cpu.time{cpu.mode=user|system}
+//   - process.memory.usage and process.memory.virtual
+//   - process.thread.count and process.open_file_descriptor.count
+//   - process.uptime
+//   - system.cpu.time{cpu.mode=user|nice|system|idle|iowait|interrupt|steal}
+//   - system.cpu.logical.count
+//   - system.memory.usage{system.memory.state=used|free|buffers|cached} and
+//     system.memory.limit
+//   - system.network.io{network.interface.name, network.io.direction}
+//
+// In a container the system.cpu.* and system.memory.* values are the
+// host's, system.network.io covers the container's interfaces.
+func Start(mp metric.MeterProvider) error {
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter(instrumentationName)
+
+	procCPU, err := meter.Float64ObservableCounter("process.cpu.time",
+		metric.WithDescription("Total CPU seconds broken down by different CPU modes."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+	procMemory, err := meter.Int64ObservableUpDownCounter("process.memory.usage",
+		metric.WithDescription("The amount of physical memory in use."),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return err
+	}
+	procVirtual, err := meter.Int64ObservableUpDownCounter("process.memory.virtual",
+		metric.WithDescription("The amount of committed virtual memory."),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return err
+	}
+	procThreads, err := meter.Int64ObservableUpDownCounter("process.thread.count",
+		metric.WithDescription("Process threads count."),
+		metric.WithUnit("{thread}"),
+	)
+	if err != nil {
+		return err
+	}
+	procFDs, err := meter.Int64ObservableUpDownCounter("process.open_file_descriptor.count",
+		metric.WithDescription("Number of file descriptors in use by the process."),
+		metric.WithUnit("{file_descriptor}"),
+	)
+	if err != nil {
+		return err
+	}
+	procUptime, err := meter.Float64ObservableGauge("process.uptime",
+		metric.WithDescription("The time the process has been running."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+	sysCPU, err := meter.Float64ObservableCounter("system.cpu.time",
+		metric.WithDescription("Seconds each logical CPU spent on each mode."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+	sysCPUs, err := meter.Int64ObservableUpDownCounter("system.cpu.logical.count",
+		metric.WithDescription("Reports the number of logical (virtual) processor cores usable by the process."),
+		metric.WithUnit("{cpu}"),
+	)
+	if err != nil {
+		return err
+	}
+	sysMemory, err := meter.Int64ObservableUpDownCounter("system.memory.usage",
+		metric.WithDescription("Reports memory in use by state."),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return err
+	}
+	sysMemoryLimit, err := meter.Int64ObservableUpDownCounter("system.memory.limit",
+		metric.WithDescription("Total virtual memory available in the system."),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return err
+	}
+	sysNetwork, err := meter.Int64ObservableCounter("system.network.io",
+		metric.WithDescription("The number of bytes transmitted and received."),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		var ru syscall.Rusage
+		if syscall.Getrusage(syscall.RUSAGE_SELF, &ru) == nil {
+			o.ObserveFloat64(procCPU, seconds(ru.Utime), cpuMode("user"))
+			o.ObserveFloat64(procCPU, seconds(ru.Stime), cpuMode("system"))
+		}
+		if status, err := readFields(statusFile); err == nil {
+			o.ObserveInt64(procMemory, status["VmRSS"])
+			o.ObserveInt64(procVirtual, status["VmSize"])
+			o.ObserveInt64(procThreads, status["Threads"])
+		}
+		if fds, err := os.ReadDir(fdDir); err == nil {
+			o.ObserveInt64(procFDs, int64(len(fds)))
+		}
+		o.ObserveFloat64(procUptime, time.Since(startTime).Seconds())
+
+		if times, err := readCPUTimes(statFile); err == nil {
+			for mode, t := range times {
+				o.ObserveFloat64(sysCPU, t, cpuMode(mode))
+			}
+		}
+		o.ObserveInt64(sysCPUs, int64(runtime.NumCPU()))
+		if mem, err := readFields(meminfoFile); err == nil {
+			free, buffers, cached := mem["MemFree"], mem["Buffers"], mem["Cached"]
+			o.ObserveInt64(sysMemory, mem["MemTotal"]-free-buffers-cached, memoryState("used"))
+			o.ObserveInt64(sysMemory, free, memoryState("free"))
+			o.ObserveInt64(sysMemory, buffers, memoryState("buffers"))
+			o.ObserveInt64(sysMemory, cached, memoryState("cached"))
+			o.ObserveInt64(sysMemoryLimit, mem["MemTotal"])
+		}
+		if ifaces, err := readNetDev(netDevFile); err == nil {
+			for _, i := range ifaces {
+				name := attribute.String("network.interface.name", i.name)
+				o.ObserveInt64(sysNetwork, i.received, metric.WithAttributes(name, attribute.String("network.io.direction", "receive")))
+				o.ObserveInt64(sysNetwork, i.transmitted, metric.WithAttributes(name, attribute.String("network.io.direction", "transmit")))
+			}
+		}
+		return nil
+	}, procCPU, procMemory, procVirtual, procThreads, procFDs, procUptime,
+		sysCPU, sysCPUs, sysMemory, sysMemoryLimit, sysNetwork)
+	return err
+}
+
+func cpuMode(mode string) metric.ObserveOption {
+	return metric.WithAttributes(attribute.String("cpu.mode", mode))
+}
+
+func memoryState(state string) metric.ObserveOption {
+	return metric.WithAttributes(attribute.String("system.memory.state", state))
+}
+
+func seconds(tv syscall.Timeval) float64 {
+	return float64(tv.Sec) + float64(tv.Usec)/1e6
+}
+
+// readFields reads a "Key: value [kB]" file such as /proc/self/status or
+// /proc/meminfo. Values in kB are returned in bytes; non-numeric fields are
+// skipped.
+func readFields(path string) (map[string]int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fields := make(map[string]int64)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		key, rest, ok := strings.Cut(s.Text(), ":")
+		if !ok {
+			continue
+		}
+		value := strings.Fields(rest)
+		if len(value) == 0 {
+			continue
+		}
+		n, err := strconv.ParseInt(value[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(value) > 1 && value[1] == "kB" {
+			n *= 1024
+		}
+		fields[key] = n
+	}
+	return fields, s.Err()
+}
+
+// cpuModes are the columns of the "cpu" line of /proc/stat, in order.
+var cpuModes = []string{"user", "nice", "system", "idle", "iowait", "interrupt", "softirq", "steal"}
+
+// readCPUTimes returns the seconds all CPUs spent in each mode from a
+// /proc/stat file. softirq is counted as interrupt, as the semantic
+// conventions have no mode for it. Columns that are missing or not numbers
+// are left out.
+func readCPUTimes(path string) (map[string]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || fields[0] != "cpu" {
+			continue
+		}
+		times := make(map[string]float64, len(cpuModes))
+		for i, mode := range cpuModes {
+			if i+1 >= len(fields) {
+				break
+			}
+			ticks, err := strconv.ParseUint(fields[i+1], 10, 64)
+			if err != nil {
+				continue
+			}
+			if mode == "softirq" {
+				mode = "interrupt"
+			}
+			times[mode] += float64(ticks) / userHZ
+		}
+		return times, nil
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no cpu line in %s", path)
+}
+
+type netDev struct {
+	name                  string
+	received, transmitted int64
+}
+
+// readNetDev returns the byte counters of a /proc/net/dev file. Lines that
+// are not interfaces with numeric counters are skipped.
+func readNetDev(path string) ([]netDev, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var devs []netDev
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// "  eth0: rx_bytes rx_packets ... (8 columns) tx_bytes ..."
+		name, rest, ok := strings.Cut(s.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) < 9 {
+			continue
+		}
+		rx, err1 := strconv.ParseInt(fields[0], 10, 64)
+		tx, err2 := strconv.ParseInt(fields[8], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		devs = append(devs, netDev{name: strings.TrimSpace(name), received: rx, transmitted: tx})
+	}
+	return devs, s.Err()
+}
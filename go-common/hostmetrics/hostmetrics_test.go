@@ -0,0 +1,170 @@
+package hostmetrics
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// procFile writes a fixture for one of the /proc files into a temporary
+// directory and returns its path.
+func procFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "proc")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadFields(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		content string
+		want    map[string]int64
+	}{
+		{
+			name: "meminfo",
+			content: "MemTotal:        2048 kB\n" +
+				"MemFree:          512 kB\n" +
+				"HugePages_Total:    4\n",
+			want: map[string]int64{"MemTotal": 2048 * 1024, "MemFree": 512 * 1024, "HugePages_Total": 4},
+		},
+		{
+			name: "status",
+			content: "Name:\tgo-pricing-serv\n" +
+				"Threads:\t12\n" +
+				"VmRSS:\t  10240 kB\n",
+			want: map[string]int64{"Threads": 12, "VmRSS": 10240 * 1024},
+		},
+		{
+			name: "malformed lines",
+			content: "no colon here\n" +
+				"Empty:\n" +
+				"NotANumber: abc kB\n" +
+				"MemAvailable: 1 kB\n",
+			want: map[string]int64{"MemAvailable": 1024},
+		},
+		{name: "empty", content: "", want: map[string]int64{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readFields(procFile(t, tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readFields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCPUTimes(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		content string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{
+			name: "all columns",
+			content: "cpu  100 200 300 400 500 600 700 800 900 1000\n" +
+				"cpu0 50 100 150 200 250 300 350 400 450 500\n" +
+				"intr 12345\n",
+			want: map[string]float64{
+				"user": 1, "nice": 2, "system": 3, "idle": 4,
+				"iowait": 5, "interrupt": 13, "steal": 8,
+			},
+		},
+		{
+			// Kernels before 2.6.11 have no steal column.
+			name:    "short line",
+			content: "cpu  100 200 300 400\n",
+			want:    map[string]float64{"user": 1, "nice": 2, "system": 3, "idle": 4},
+		},
+		{
+			name:    "non-numeric column",
+			content: "cpu  100 x 300 400 500 600 700 800\n",
+			want: map[string]float64{
+				"user": 1, "system": 3, "idle": 4,
+				"iowait": 5, "interrupt": 13, "steal": 8,
+			},
+		},
+		{
+			name:    "no cpu line",
+			content: "cpu0 100 200 300 400\nintr 12345\n",
+			wantErr: true,
+		},
+		{name: "empty", content: "", wantErr: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readCPUTimes(procFile(t, tt.content))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("readCPUTimes = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readCPUTimes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadNetDev(t *testing.T) {
+	const header = "Inter-|   Receive                                                |  Transmit\n" +
+		" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n"
+	for _, tt := range []struct {
+		name    string
+		content string
+		want    []netDev
+	}{
+		{
+			name: "interfaces",
+			content: header +
+				"    lo:    1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0\n" +
+				"  eth0:12345678   9000    0    0    0     0          0         0  8765432    7000    0    0    0     0       0          0\n",
+			want: []netDev{
+				{name: "lo", received: 1000, transmitted: 1000},
+				{name: "eth0", received: 12345678, transmitted: 8765432},
+			},
+		},
+		{
+			name: "malformed lines",
+			content: header +
+				"  eth0: 1 2 3\n" +
+				"  eth1: x 0 0 0 0 0 0 0 5 0 0 0 0 0 0 0\n" +
+				"  eth2: 7 0 0 0 0 0 0 0 9 0 0 0 0 0 0 0\n",
+			want: []netDev{{name: "eth2", received: 7, transmitted: 9}},
+		},
+		{name: "header only", content: header},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readNetDev(procFile(t, tt.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readNetDev = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing")
+	if _, err := readFields(path); !os.IsNotExist(err) {
+		t.Errorf("readFields: err = %v, want not exist", err)
+	}
+	if _, err := readCPUTimes(path); !os.IsNotExist(err) {
+		t.Errorf("readCPUTimes: err = %v, want not exist", err)
+	}
+	if _, err := readNetDev(path); !os.IsNotExist(err) {
+		t.Errorf("readNetDev: err = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,415 @@
+// Package notification sends the pricing notifications to the Java
+// service's /notifications/send. A Client reuses its connections, bounds
+// every attempt with a timeout and each notification with a budget, and
+// stops calling a failing service for a while (circuit breaker), so a slow
+// or stopped Java service costs a pricing request a few seconds at most.
+//
+// The POST is not idempotent: a notification sent twice is delivered twice.
+// Send therefore retries, with jittered exponential backoff, only the
+// attempts that provably did not reach the service: those that failed
+// before a connection was obtained, and 429 responses, which refuse the
+// request without processing it. A 502, 503 or 504 from a proxy, or an
+// error once the request may have gone out, is not retried. Send reports
+// the outcome as a Result for the pricing response:
+//
+//	c, _ := notification.New(notification.Config{URL: "http://java-service:8081"})
+//	res := c.Send(ctx, notification.Notification{Recipient: to, Message: msg, Type: "pricing_notification"})
+//	// res.Status is sent, rejected, failed or circuit_open
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "github.com/nutslove/otel-instrumentation-demo/go-common/notification"
+
+// Defaults for the zero Config fields.
+const (
+	DefaultTimeout          = 2 * time.Second
+	DefaultBudget           = 3 * time.Second
+	DefaultMaxAttempts      = 3
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// Retry backoff: doubled after each failed attempt up to maxBackoff, with
+// up to half of it taken off at random.
+const (
+	initialBackoff = 100 * time.Millisecond
+	maxBackoff     = time.Second
+)
+
+// Config configures a Client.
+type Config struct {
+	// URL is the Java service's base URL, e.g. http://java-service:8081.
+	URL string
+	// Transport sends the requests (NewTransport() when nil); RoundTrippers
+	// adding headers, such as headerprop.Transport, wrap it.
+	Transport http.RoundTripper
+	// Timeout bounds each attempt, reading the response included.
+	Timeout time.Duration
+	// Budget bounds Send as a whole, retries included, like the deadline of
+	// the context passed to Send: no retry starts after either. Send keeps
+	// the request path it is called on short that way.
+	Budget time.Duration
+	// MaxAttempts is the number of attempts per notification, the first
+	// one included.
+	MaxAttempts int
+	// BreakerThreshold consecutive failed notifications open the circuit
+	// breaker: for BreakerCooldown Send fails at once with
+	// StatusCircuitOpen, then a single notification probes the service and
+	// closes the breaker again if it gets through.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// Logger, when set, logs every failed attempt that is retried.
+	Logger *slog.Logger
+	// MeterProvider records the client's metrics (the global one when nil).
+	MeterProvider metric.MeterProvider
+}
+
+// Notification is the request body of /notifications/send.
+type Notification struct {
+	Recipient string `json:"recipient"`
+	Message   string `json:"message"`
+	Type      string `json:"type"`
+}
+
+// Status is the outcome of a notification.
+type Status string
+
+const (
+	// StatusSent: the Java service accepted the notification (2xx).
+	StatusSent Status = "sent"
+	// StatusRejected: the Java service answered with a status not worth
+	// retrying, such as 400 or 500.
+	StatusRejected Status = "rejected"
+	// StatusFailed: no answer, or the service or a proxy in front of it
+	// was unavailable (429, 502, 503, 504), on the last attempt.
+	StatusFailed Status = "failed"
+	// StatusCircuitOpen: not attempted, the circuit breaker is open.
+	StatusCircuitOpen Status = "circuit_open"
+)
+
+// Result reports what happened to a notification.
+type Result struct {
+	Status Status `json:"status"`
+	// Attempts is the number of requests sent (0 when the breaker is open).
+	Attempts int `json:"attempts"`
+	// StatusCode is the HTTP status of the last response, if there was one.
+	StatusCode int `json:"status_code,omitempty"`
+	// Error describes the last failure.
+	Error string `json:"error,omitempty"`
+	// Body is the Java service's response to a sent notification.
+	Body string `json:"-"`
+}
+
+// Client sends notifications. It is safe for concurrent use.
+type Client struct {
+	cfg     Config
+	url     string
+	http    *http.Client
+	breaker *breaker
+
+	attempts metric.Int64Counter
+	retries  metric.Int64Counter
+}
+
+// NewTransport returns the transport a Client uses by default:
+// http.DefaultTransport's settings with more idle connections kept, since
+// every request goes to the same host.
+func NewTransport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = 32
+	return t
+}
+
+// New returns a Client for cfg.
+func New(cfg Config) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("notification: URL is required")
+	}
+	if cfg.Transport == nil {
+		cfg.Transport = NewTransport()
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.Budget <= 0 {
+		cfg.Budget = DefaultBudget
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = DefaultMaxAttempts
+	}
+	if cfg.BreakerThreshold <= 0 {
+		cfg.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = DefaultBreakerCooldown
+	}
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+
+	c := &Client{
+		cfg:     cfg,
+		url:     strings.TrimSuffix(cfg.URL, "/") + "/notifications/send",
+		http:    &http.Client{Transport: cfg.Transport},
+		breaker: &breaker{threshold: cfg.BreakerThreshold, cooldown: cfg.BreakerCooldown},
+	}
+	if err := c.initMetrics(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// URL returns the endpoint the notifications are sent to.
+func (c *Client) URL() string {
+	return c.url
+}
+
+// Send posts n, retrying as configured, and reports the outcome. The
+// requests carry ctx, so RoundTrippers see the incoming request's context.
+// Send returns within the Budget and by the deadline of ctx.
+func (c *Client) Send(ctx context.Context, n Notification) Result {
+	if !c.breaker.allow() {
+		return Result{Status: StatusCircuitOpen, Error: "notification: circuit breaker open"}
+	}
+	payload, err := json.Marshal(n)
+	if err != nil {
+		c.breaker.release()
+		return Result{Status: StatusRejected, Error: fmt.Sprintf("notification: %v", err)}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Budget)
+	defer cancel()
+
+	var res Result
+	for attempt := 1; ; attempt++ {
+		var retry bool
+		res, retry = c.attempt(ctx, payload)
+		res.Attempts = attempt
+		c.attempts.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", string(res.Status))))
+		if !retry || attempt == c.cfg.MaxAttempts {
+			break
+		}
+
+		wait := backoff(attempt - 1)
+		if deadline, _ := ctx.Deadline(); time.Until(deadline) <= wait {
+			// No time left for another attempt
+			break
+		}
+		if c.cfg.Logger != nil {
+			c.cfg.Logger.WarnContext(ctx, fmt.Sprintf("Notification attempt %d failed, retrying in %s: %s", attempt, wait.Round(time.Millisecond), res.Error))
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			res.Error = fmt.Sprintf("notification: %v after %s", ctx.Err(), res.Error)
+			c.breaker.release() // not the service's fault
+			return res
+		}
+		c.retries.Add(ctx, 1)
+	}
+
+	// A response below 500 shows the service is up, whatever it says.
+	c.breaker.done(res.Status == StatusSent || res.Status == StatusRejected && res.StatusCode < 500)
+	return res
+}
+
+// attempt sends payload once and reports whether it may be retried, i.e.
+// whether the service certainly did not process it.
+func (c *Client) attempt(ctx context.Context, payload []byte) (Result, bool) {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	// Without a connection nothing was sent. Once there is one, the request
+	// may have been written before the error; net/http itself replays it
+	// on a new connection when a reused one failed before any byte went out.
+	var connected atomic.Bool
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) { connected.Store(true) },
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(payload))
+	if err != nil {
+		return Result{Status: StatusRejected, Error: fmt.Sprintf("notification: %v", err)}, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return Result{Status: StatusFailed, Error: fmt.Sprintf("notification: %v", err)}, !connected.Load()
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+
+	res := Result{StatusCode: resp.StatusCode}
+	switch {
+	case err != nil:
+		res.Status = StatusFailed
+		res.Error = fmt.Sprintf("notification: failed to read response: %v", err)
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		res.Status = StatusSent
+		res.Body = string(body)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		res.Status = StatusFailed
+		res.Error = fmt.Sprintf("notification: %s responded with %s", c.url, resp.Status)
+		return res, true
+	case resp.StatusCode == http.StatusBadGateway, resp.StatusCode == http.StatusServiceUnavailable,
+		resp.StatusCode == http.StatusGatewayTimeout:
+		// A proxy cannot tell whether the service got the request
+		res.Status = StatusFailed
+		res.Error = fmt.Sprintf("notification: %s responded with %s", c.url, resp.Status)
+	default:
+		res.Status = StatusRejected
+		res.Error = fmt.Sprintf("notification: %s responded with %s", c.url, resp.Status)
+	}
+	return res, false
+}
+
+func backoff(failures int) time.Duration {
+	d := maxBackoff
+	if failures < 4 {
+		d = min(initialBackoff<<failures, maxBackoff)
+	}
+	return d - rand.N(d/2)
+}
+
+// breakerState is the state of a breaker.
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker is a consecutive-failure circuit breaker. Once open, the first
+// call after the cooldown is let through (half-open) and decides whether it
+// closes or opens again; other calls fail meanwhile.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+func (b *breaker) done(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ok {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// release ends a call that says nothing about the service, such as one
+// canceled by the caller. A probe's slot goes to the next call.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+}
+
+func (b *breaker) current() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// initMetrics creates the client's instruments:
+//
+//   - notification.attempts{outcome=sent|rejected|failed}: requests sent
+//   - notification.retries: attempts that were followed by another one
+//   - notification.breaker.state{state=closed|open|half_open}: 1 for the
+//     breaker's current state, 0 for the others
+func (c *Client) initMetrics() error {
+	meter := c.cfg.MeterProvider.Meter(instrumentationName)
+
+	var err error
+	c.attempts, err = meter.Int64Counter("notification.attempts",
+		metric.WithDescription("Number of requests sent to the notification service."),
+		metric.WithUnit("{attempt}"),
+	)
+	if err != nil {
+		return err
+	}
+	c.retries, err = meter.Int64Counter("notification.retries",
+		metric.WithDescription("Number of notification requests retried."),
+		metric.WithUnit("{retry}"),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = meter.Int64ObservableGauge("notification.breaker.state",
+		metric.WithDescription("State of the notification circuit breaker (1 for the current state)."),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			current := c.breaker.current()
+			for _, s := range []breakerState{breakerClosed, breakerOpen, breakerHalfOpen} {
+				var v int64
+				if s == current {
+					v = 1
+				}
+				o.Observe(v, metric.WithAttributes(attribute.String("state", s.String())))
+			}
+			return nil
+		}),
+	)
+	return err
+}
@@ -0,0 +1,180 @@
+package notification
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+var pricing = Notification{Recipient: "pricing-service@example.com", Message: "Laptop x 2", Type: "pricing_notification"}
+
+// javaStub stands in for the Java service: it answers the requests with
+// the given statuses in turn, then with 200, and counts the bodies it read.
+type javaStub struct {
+	*httptest.Server
+	received atomic.Int32
+}
+
+func newJavaStub(t *testing.T, statuses ...int) *javaStub {
+	t.Helper()
+	s := &javaStub{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		n := int(s.received.Add(1))
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		w.Write([]byte(`{"status":"SENT"}`))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newClient(t *testing.T, cfg Config) *Client {
+	t.Helper()
+	cfg.MeterProvider = noop.NewMeterProvider()
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// stoppedURL returns the URL of a server that is no longer listening.
+func stoppedURL() string {
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+	return s.URL
+}
+
+func TestSend(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		statuses []int
+		want     Status
+		attempts int
+	}{
+		{"sent", nil, StatusSent, 1},
+		{"rejected", []int{http.StatusBadRequest}, StatusRejected, 1},
+		{"server error", []int{http.StatusInternalServerError}, StatusRejected, 1},
+		// 429 refuses the request before processing it
+		{"too many requests", []int{http.StatusTooManyRequests}, StatusSent, 2},
+		{"too many requests throughout", []int{429, 429, 429}, StatusFailed, 3},
+		// The service may have processed what a proxy answered for
+		{"bad gateway", []int{http.StatusBadGateway}, StatusFailed, 1},
+		{"unavailable", []int{http.StatusServiceUnavailable}, StatusFailed, 1},
+		{"gateway timeout", []int{http.StatusGatewayTimeout}, StatusFailed, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			java := newJavaStub(t, tt.statuses...)
+			c := newClient(t, Config{URL: java.URL})
+
+			res := c.Send(context.Background(), pricing)
+			if res.Status != tt.want || res.Attempts != tt.attempts {
+				t.Errorf("Send() = %s after %d attempts, want %s after %d: %+v", res.Status, res.Attempts, tt.want, tt.attempts, res)
+			}
+			if got := int(java.received.Load()); got != tt.attempts {
+				t.Errorf("Java service received %d notifications, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestSendConnectionRefused(t *testing.T) {
+	// Nothing went out, so every attempt is made.
+	c := newClient(t, Config{URL: stoppedURL()})
+	res := c.Send(context.Background(), pricing)
+	if res.Status != StatusFailed || res.Attempts != DefaultMaxAttempts {
+		t.Errorf("Send() = %s after %d attempts, want failed after %d", res.Status, res.Attempts, DefaultMaxAttempts)
+	}
+}
+
+func TestSendConnectionLost(t *testing.T) {
+	// The service read the notification and dropped the connection before
+	// answering: it may have processed it, so it is not sent again.
+	var received atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		received.Add(1)
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	c := newClient(t, Config{URL: srv.URL})
+	res := c.Send(context.Background(), pricing)
+	if res.Status != StatusFailed || res.Attempts != 1 {
+		t.Errorf("Send() = %s after %d attempts, want failed after 1", res.Status, res.Attempts)
+	}
+	if got := received.Load(); got != 1 {
+		t.Errorf("Java service received %d notifications, want 1", got)
+	}
+}
+
+func TestSendBudget(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		cfg    Config
+		ctxTTL time.Duration
+	}{
+		// The first backoff is at least 50ms
+		{"budget", Config{Budget: 40 * time.Millisecond}, 0},
+		{"deadline", Config{}, 40 * time.Millisecond},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.URL = stoppedURL()
+			c := newClient(t, tt.cfg)
+			ctx := context.Background()
+			if tt.ctxTTL > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.ctxTTL)
+				defer cancel()
+			}
+
+			start := time.Now()
+			res := c.Send(ctx, pricing)
+			if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+				t.Errorf("Send() took %s, want at most 40ms", elapsed)
+			}
+			if res.Status != StatusFailed || res.Attempts != 1 {
+				t.Errorf("Send() = %s after %d attempts, want failed after 1", res.Status, res.Attempts)
+			}
+		})
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	java := newJavaStub(t, http.StatusInternalServerError, http.StatusInternalServerError)
+	c := newClient(t, Config{URL: java.URL, BreakerThreshold: 2, BreakerCooldown: 50 * time.Millisecond})
+
+	for range 2 {
+		if res := c.Send(context.Background(), pricing); res.Status != StatusRejected {
+			t.Fatalf("Send() = %s, want rejected", res.Status)
+		}
+	}
+	if res := c.Send(context.Background(), pricing); res.Status != StatusCircuitOpen || res.Attempts != 0 {
+		t.Errorf("Send() with the breaker open = %s after %d attempts, want circuit_open after 0", res.Status, res.Attempts)
+	}
+
+	// After the cooldown a probe goes through and closes the breaker.
+	time.Sleep(60 * time.Millisecond)
+	for range 2 {
+		if res := c.Send(context.Background(), pricing); res.Status != StatusSent {
+			t.Errorf("Send() after the cooldown = %s, want sent", res.Status)
+		}
+	}
+	if got := java.received.Load(); got != 4 {
+		t.Errorf("Java service received %d notifications, want 4", got)
+	}
+}
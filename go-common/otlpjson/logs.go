@@ -0,0 +1,124 @@
+package otlpjson
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	collogpb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logpb "go.opentelemetry.io/proto/otlp/logs/v1"
+)
+
+// LogExporter posts log records as OTLP/JSON.
+type LogExporter struct {
+	c *client
+}
+
+var _ sdklog.Exporter = (*LogExporter)(nil)
+
+// NewLogExporter returns a LogExporter for use with a BatchProcessor.
+func NewLogExporter(cfg Config) *LogExporter {
+	return &LogExporter{c: newClient(cfg)}
+}
+
+func (e *LogExporter) Export(ctx context.Context, records []sdklog.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return e.c.post(ctx, &collogpb.ExportLogsServiceRequest{ResourceLogs: ResourceLogs(records)})
+}
+
+func (e *LogExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *LogExporter) Shutdown(context.Context) error {
+	e.c.close()
+	return nil
+}
+
+// ResourceLogs converts records to their OTLP form, grouped by resource and
+// instrumentation scope in the order in which they were first seen.
+func ResourceLogs(records []sdklog.Record) []*logpb.ResourceLogs {
+	var out []*logpb.ResourceLogs
+	byResource := map[*resource.Resource]*logpb.ResourceLogs{}
+	byScope := map[*resource.Resource]map[instrumentation.Scope]*logpb.ScopeLogs{}
+
+	for _, r := range records {
+		res := r.Resource()
+		rl, ok := byResource[res]
+		if !ok {
+			rl = &logpb.ResourceLogs{Resource: resourceProto(res)}
+			if res != nil {
+				rl.SchemaUrl = res.SchemaURL()
+			}
+			byResource[res] = rl
+			byScope[res] = map[instrumentation.Scope]*logpb.ScopeLogs{}
+			out = append(out, rl)
+		}
+
+		scope := r.InstrumentationScope()
+		sl, ok := byScope[res][scope]
+		if !ok {
+			sl = &logpb.ScopeLogs{Scope: scopeProto(scope), SchemaUrl: scope.SchemaURL}
+			byScope[res][scope] = sl
+			rl.ScopeLogs = append(rl.ScopeLogs, sl)
+		}
+		sl.LogRecords = append(sl.LogRecords, logRecord(r))
+	}
+	return out
+}
+
+func logRecord(r sdklog.Record) *logpb.LogRecord {
+	pb := &logpb.LogRecord{
+		TimeUnixNano:           unixNano(r.Timestamp()),
+		ObservedTimeUnixNano:   unixNano(r.ObservedTimestamp()),
+		SeverityNumber:         logpb.SeverityNumber(r.Severity()),
+		SeverityText:           r.SeverityText(),
+		Body:                   logValue(r.Body()),
+		DroppedAttributesCount: uint32(r.DroppedAttributes()),
+		Flags:                  uint32(r.TraceFlags()),
+		EventName:              r.EventName(),
+	}
+	if tid := r.TraceID(); tid.IsValid() {
+		pb.TraceId = tid[:]
+	}
+	if sid := r.SpanID(); sid.IsValid() {
+		pb.SpanId = sid[:]
+	}
+	r.WalkAttributes(func(kv log.KeyValue) bool {
+		pb.Attributes = append(pb.Attributes, &commonpb.KeyValue{Key: kv.Key, Value: logValue(kv.Value)})
+		return true
+	})
+	return pb
+}
+
+func logValue(v log.Value) *commonpb.AnyValue {
+	switch v.Kind() {
+	case log.KindBool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v.AsBool()}}
+	case log.KindInt64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v.AsInt64()}}
+	case log.KindFloat64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v.AsFloat64()}}
+	case log.KindString:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v.AsString()}}
+	case log.KindBytes:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: v.AsBytes()}}
+	case log.KindSlice:
+		arr := &commonpb.ArrayValue{}
+		for _, item := range v.AsSlice() {
+			arr.Values = append(arr.Values, logValue(item))
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: arr}}
+	case log.KindMap:
+		kvl := &commonpb.KeyValueList{}
+		for _, kv := range v.AsMap() {
+			kvl.Values = append(kvl.Values, &commonpb.KeyValue{Key: kv.Key, Value: logValue(kv.Value)})
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: kvl}}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,251 @@
+package otlpjson
+
+import (
+	"context"
+	"fmt"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// MetricExporter posts metrics as OTLP/JSON. It uses the SDK's default
+// temporality and aggregation selectors, like the OTLP/HTTP exporter.
+type MetricExporter struct {
+	c *client
+}
+
+var _ sdkmetric.Exporter = (*MetricExporter)(nil)
+
+// NewMetricExporter returns a MetricExporter for use with a PeriodicReader.
+func NewMetricExporter(cfg Config) *MetricExporter {
+	return &MetricExporter{c: newClient(cfg)}
+}
+
+func (e *MetricExporter) Temporality(k sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(k)
+}
+
+func (e *MetricExporter) Aggregation(k sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(k)
+}
+
+func (e *MetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	pb, err := ResourceMetrics(rm)
+	if err != nil {
+		return err
+	}
+	return e.c.post(ctx, &colmetricpb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricpb.ResourceMetrics{pb},
+	})
+}
+
+func (e *MetricExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *MetricExporter) Shutdown(context.Context) error {
+	e.c.close()
+	return nil
+}
+
+// ResourceMetrics converts rm to its OTLP form.
+func ResourceMetrics(rm *metricdata.ResourceMetrics) (*metricpb.ResourceMetrics, error) {
+	out := &metricpb.ResourceMetrics{Resource: resourceProto(rm.Resource)}
+	if rm.Resource != nil {
+		out.SchemaUrl = rm.Resource.SchemaURL()
+	}
+	for _, sm := range rm.ScopeMetrics {
+		spb := &metricpb.ScopeMetrics{Scope: scopeProto(sm.Scope), SchemaUrl: sm.Scope.SchemaURL}
+		for _, m := range sm.Metrics {
+			mpb, err := metricProto(m)
+			if err != nil {
+				return nil, err
+			}
+			spb.Metrics = append(spb.Metrics, mpb)
+		}
+		out.ScopeMetrics = append(out.ScopeMetrics, spb)
+	}
+	return out, nil
+}
+
+func metricProto(m metricdata.Metrics) (*metricpb.Metric, error) {
+	out := &metricpb.Metric{Name: m.Name, Description: m.Description, Unit: m.Unit}
+	switch a := m.Data.(type) {
+	case metricdata.Gauge[int64]:
+		out.Data = &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{DataPoints: numberPoints(a.DataPoints)}}
+	case metricdata.Gauge[float64]:
+		out.Data = &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{DataPoints: numberPoints(a.DataPoints)}}
+	case metricdata.Sum[int64]:
+		out.Data = &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+			AggregationTemporality: temporality(a.Temporality),
+			IsMonotonic:            a.IsMonotonic,
+			DataPoints:             numberPoints(a.DataPoints),
+		}}
+	case metricdata.Sum[float64]:
+		out.Data = &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+			AggregationTemporality: temporality(a.Temporality),
+			IsMonotonic:            a.IsMonotonic,
+			DataPoints:             numberPoints(a.DataPoints),
+		}}
+	case metricdata.Histogram[int64]:
+		out.Data = &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+			AggregationTemporality: temporality(a.Temporality),
+			DataPoints:             histogramPoints(a.DataPoints),
+		}}
+	case metricdata.Histogram[float64]:
+		out.Data = &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+			AggregationTemporality: temporality(a.Temporality),
+			DataPoints:             histogramPoints(a.DataPoints),
+		}}
+	case metricdata.ExponentialHistogram[int64]:
+		out.Data = &metricpb.Metric_ExponentialHistogram{ExponentialHistogram: &metricpb.ExponentialHistogram{
+			AggregationTemporality: temporality(a.Temporality),
+			DataPoints:             expHistogramPoints(a.DataPoints),
+		}}
+	case metricdata.ExponentialHistogram[float64]:
+		out.Data = &metricpb.Metric_ExponentialHistogram{ExponentialHistogram: &metricpb.ExponentialHistogram{
+			AggregationTemporality: temporality(a.Temporality),
+			DataPoints:             expHistogramPoints(a.DataPoints),
+		}}
+	case metricdata.Summary:
+		out.Data = &metricpb.Metric_Summary{Summary: &metricpb.Summary{DataPoints: summaryPoints(a.DataPoints)}}
+	default:
+		return nil, fmt.Errorf("otlpjson: unsupported aggregation %T for metric %q", m.Data, m.Name)
+	}
+	return out, nil
+}
+
+func temporality(t metricdata.Temporality) metricpb.AggregationTemporality {
+	switch t {
+	case metricdata.DeltaTemporality:
+		return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+	case metricdata.CumulativeTemporality:
+		return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+	default:
+		return metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED
+	}
+}
+
+func numberPoints[N int64 | float64](dps []metricdata.DataPoint[N]) []*metricpb.NumberDataPoint {
+	out := make([]*metricpb.NumberDataPoint, 0, len(dps))
+	for _, dp := range dps {
+		pb := &metricpb.NumberDataPoint{
+			Attributes:        keyValues(dp.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(dp.StartTime),
+			TimeUnixNano:      unixNano(dp.Time),
+			Exemplars:         exemplars(dp.Exemplars),
+		}
+		switch v := any(dp.Value).(type) {
+		case int64:
+			pb.Value = &metricpb.NumberDataPoint_AsInt{AsInt: v}
+		case float64:
+			pb.Value = &metricpb.NumberDataPoint_AsDouble{AsDouble: v}
+		}
+		out = append(out, pb)
+	}
+	return out
+}
+
+func histogramPoints[N int64 | float64](dps []metricdata.HistogramDataPoint[N]) []*metricpb.HistogramDataPoint {
+	out := make([]*metricpb.HistogramDataPoint, 0, len(dps))
+	for _, dp := range dps {
+		sum := float64(dp.Sum)
+		pb := &metricpb.HistogramDataPoint{
+			Attributes:        keyValues(dp.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(dp.StartTime),
+			TimeUnixNano:      unixNano(dp.Time),
+			Count:             dp.Count,
+			Sum:               &sum,
+			BucketCounts:      dp.BucketCounts,
+			ExplicitBounds:    dp.Bounds,
+			Exemplars:         exemplars(dp.Exemplars),
+			Min:               extremum(dp.Min),
+			Max:               extremum(dp.Max),
+		}
+		out = append(out, pb)
+	}
+	return out
+}
+
+func expHistogramPoints[N int64 | float64](dps []metricdata.ExponentialHistogramDataPoint[N]) []*metricpb.ExponentialHistogramDataPoint {
+	out := make([]*metricpb.ExponentialHistogramDataPoint, 0, len(dps))
+	for _, dp := range dps {
+		sum := float64(dp.Sum)
+		pb := &metricpb.ExponentialHistogramDataPoint{
+			Attributes:        keyValues(dp.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(dp.StartTime),
+			TimeUnixNano:      unixNano(dp.Time),
+			Count:             dp.Count,
+			Sum:               &sum,
+			Scale:             dp.Scale,
+			ZeroCount:         dp.ZeroCount,
+			ZeroThreshold:     dp.ZeroThreshold,
+			Positive: &metricpb.ExponentialHistogramDataPoint_Buckets{
+				Offset:       dp.PositiveBucket.Offset,
+				BucketCounts: dp.PositiveBucket.Counts,
+			},
+			Negative: &metricpb.ExponentialHistogramDataPoint_Buckets{
+				Offset:       dp.NegativeBucket.Offset,
+				BucketCounts: dp.NegativeBucket.Counts,
+			},
+			Exemplars: exemplars(dp.Exemplars),
+			Min:       extremum(dp.Min),
+			Max:       extremum(dp.Max),
+		}
+		out = append(out, pb)
+	}
+	return out
+}
+
+func summaryPoints(dps []metricdata.SummaryDataPoint) []*metricpb.SummaryDataPoint {
+	out := make([]*metricpb.SummaryDataPoint, 0, len(dps))
+	for _, dp := range dps {
+		pb := &metricpb.SummaryDataPoint{
+			Attributes:        keyValues(dp.Attributes.ToSlice()),
+			StartTimeUnixNano: unixNano(dp.StartTime),
+			TimeUnixNano:      unixNano(dp.Time),
+			Count:             dp.Count,
+			Sum:               dp.Sum,
+		}
+		for _, q := range dp.QuantileValues {
+			pb.QuantileValues = append(pb.QuantileValues, &metricpb.SummaryDataPoint_ValueAtQuantile{
+				Quantile: q.Quantile,
+				Value:    q.Value,
+			})
+		}
+		out = append(out, pb)
+	}
+	return out
+}
+
+func exemplars[N int64 | float64](exs []metricdata.Exemplar[N]) []*metricpb.Exemplar {
+	if len(exs) == 0 {
+		return nil
+	}
+	out := make([]*metricpb.Exemplar, 0, len(exs))
+	for _, ex := range exs {
+		pb := &metricpb.Exemplar{
+			FilteredAttributes: keyValues(ex.FilteredAttributes),
+			TimeUnixNano:       unixNano(ex.Time),
+			SpanId:             ex.SpanID,
+			TraceId:            ex.TraceID,
+		}
+		switch v := any(ex.Value).(type) {
+		case int64:
+			pb.Value = &metricpb.Exemplar_AsInt{AsInt: v}
+		case float64:
+			pb.Value = &metricpb.Exemplar_AsDouble{AsDouble: v}
+		}
+		out = append(out, pb)
+	}
+	return out
+}
+
+func extremum[N int64 | float64](e metricdata.Extrema[N]) *float64 {
+	v, ok := e.Value()
+	if !ok {
+		return nil
+	}
+	f := float64(v)
+	return &f
+}
@@ -0,0 +1,133 @@
+// Package otlpjson implements OTLP/HTTP exporters using the JSON encoding
+// (http/json). The upstream Go OTLP exporters only speak protobuf over HTTP.
+// The conversions from SDK data to OTLP messages and the JSON encoding are
+// exported for the persistent export queue (package otlpqueue).
+package otlpjson
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultTimeout bounds a single export request when Config.Timeout is zero.
+const DefaultTimeout = 10 * time.Second
+
+// Config configures where an exporter posts its payloads.
+type Config struct {
+	// URL is the full signal URL, e.g. http://otel-collector:4318/v1/traces.
+	URL     string
+	Headers map[string]string
+	Timeout time.Duration
+}
+
+type client struct {
+	cfg  Config
+	http *http.Client
+}
+
+func newClient(cfg Config) *client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	return &client{cfg: cfg, http: &http.Client{}}
+}
+
+// post sends msg as an OTLP/JSON export request.
+func (c *client) post(ctx context.Context, msg proto.Message) error {
+	body, err := Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("otlpjson: failed to marshal request: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("otlpjson: failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range c.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("otlpjson: failed to send to %s: %w", c.cfg.URL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("otlpjson: %s responded with %s", c.cfg.URL, resp.Status)
+	}
+	return nil
+}
+
+func (c *client) close() {
+	c.http.CloseIdleConnections()
+}
+
+// idFields are the bytes fields that OTLP/JSON encodes as hex instead of
+// the base64 that protojson produces.
+var idFields = map[string]bool{
+	"traceId":      true,
+	"spanId":       true,
+	"parentSpanId": true,
+}
+
+// Marshal encodes msg following the OTLP/JSON rules: enums as integers and
+// trace/span IDs as hex strings.
+func Marshal(msg proto.Message) ([]byte, error) {
+	b, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if err := hexIDs(v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func hexIDs(v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if s, ok := child.(string); ok && idFields[k] {
+				raw, err := base64.StdEncoding.DecodeString(s)
+				if err != nil {
+					return fmt.Errorf("invalid %s %q: %w", k, s, err)
+				}
+				v[k] = hex.EncodeToString(raw)
+				continue
+			}
+			if err := hexIDs(child); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if err := hexIDs(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,569 @@
+package otlpjson
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	collogpb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logpb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	traceID      = trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	spanID       = trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}
+	parentSpanID = trace.SpanID{0x53, 0x99, 0x5c, 0x3f, 0x42, 0xcd, 0x8a, 0xd8}
+
+	start = time.Unix(1700000000, 123456789)
+	end   = start.Add(250 * time.Millisecond)
+
+	res = resource.NewSchemaless(attribute.String("service.name", "go-service"))
+
+	resPB = &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+		{Key: "service.name", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "go-service"}}},
+	}}
+)
+
+// collector stands in for the Collector's OTLP/HTTP receiver and keeps the
+// bodies posted to it.
+type collector struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	bodies [][]byte
+}
+
+func newCollector(t *testing.T) *collector {
+	t.Helper()
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		c.mu.Lock()
+		c.bodies = append(c.bodies, body)
+		c.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+// only returns the single body posted to c.
+func (c *collector) only(t *testing.T) []byte {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.bodies) != 1 {
+		t.Fatalf("collector received %d requests, want 1", len(c.bodies))
+	}
+	return c.bodies[0]
+}
+
+// unmarshal decodes OTLP/JSON into msg with the OTLP protos, rejecting
+// unknown fields. protojson expects base64 for bytes fields, so the hex IDs
+// are converted back first.
+func unmarshal(t *testing.T, b []byte, msg proto.Message) {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, b)
+	}
+	if err := base64IDs(v); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := protojson.Unmarshal(b, msg); err != nil {
+		t.Fatalf("output does not decode as %T: %v\n%s", msg, err, b)
+	}
+}
+
+func base64IDs(v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if s, ok := child.(string); ok && idFields[k] {
+				raw, err := hex.DecodeString(s)
+				if err != nil {
+					return err
+				}
+				v[k] = base64.StdEncoding.EncodeToString(raw)
+				continue
+			}
+			if err := base64IDs(child); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if err := base64IDs(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// wantJSON checks that b contains each of the raw JSON fragments.
+func wantJSON(t *testing.T, b []byte, fragments ...string) {
+	t.Helper()
+	for _, f := range fragments {
+		if !strings.Contains(string(b), f) {
+			t.Errorf("output does not contain %s:\n%s", f, b)
+		}
+	}
+}
+
+func str(s string) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}
+}
+
+func intValue(i int64) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: i}}
+}
+
+func TestMarshal(t *testing.T) {
+	req := &coltracepb.ExportTraceServiceRequest{ResourceSpans: []*tracepb.ResourceSpans{{
+		Resource: resPB,
+		ScopeSpans: []*tracepb.ScopeSpans{{
+			Scope: &commonpb.InstrumentationScope{Name: "go-service"},
+			Spans: []*tracepb.Span{{
+				TraceId:           traceID[:],
+				SpanId:            spanID[:],
+				ParentSpanId:      parentSpanID[:],
+				Name:              "GET /pricing",
+				Kind:              tracepb.Span_SPAN_KIND_SERVER,
+				StartTimeUnixNano: uint64(start.UnixNano()),
+				EndTimeUnixNano:   uint64(end.UnixNano()),
+				Status:            &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: "boom"},
+				Links:             []*tracepb.Span_Link{{TraceId: traceID[:], SpanId: parentSpanID[:]}},
+			}},
+		}},
+	}}}
+
+	b, err := Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantJSON(t, b,
+		`"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+		`"spanId":"00f067aa0ba902b7"`,
+		`"parentSpanId":"53995c3f42cd8ad8"`,
+		`"spanId":"53995c3f42cd8ad8"`, // in the link
+		`"kind":2`,
+		`"code":2`,
+		`"startTimeUnixNano":"1700000000123456789"`,
+	)
+
+	var got coltracepb.ExportTraceServiceRequest
+	unmarshal(t, b, &got)
+	if !proto.Equal(&got, req) {
+		t.Errorf("round trip = %v, want %v", &got, req)
+	}
+}
+
+func TestTraceClient(t *testing.T) {
+	c := newCollector(t)
+	exp, err := otlptrace.New(context.Background(), NewTraceClient(Config{URL: c.URL + "/v1/traces"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exp.Shutdown(context.Background())
+
+	span := tracetest.SpanStub{
+		Name: "SELECT pricing",
+		SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled,
+		}),
+		Parent:    trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: parentSpanID}),
+		SpanKind:  trace.SpanKindClient,
+		StartTime: start,
+		EndTime:   end,
+		Attributes: []attribute.KeyValue{
+			attribute.String("db.system.name", "sqlite"),
+			attribute.Int64("db.response.returned_rows", 3),
+			attribute.Bool("error.flagged", true),
+			attribute.Float64("ratio", 0.5),
+			attribute.StringSlice("tags", []string{"a", "b"}),
+		},
+		Status:               sdktrace.Status{Code: codes.Error, Description: "no such table"},
+		Resource:             res,
+		InstrumentationScope: instrumentation.Scope{Name: "otelsql", Version: "0.1.0"},
+	}
+	if err := exp.ExportSpans(context.Background(), tracetest.SpanStubs{span}.Snapshots()); err != nil {
+		t.Fatal(err)
+	}
+
+	body := c.only(t)
+	wantJSON(t, body,
+		`"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+		`"spanId":"00f067aa0ba902b7"`,
+		`"parentSpanId":"53995c3f42cd8ad8"`,
+		`"kind":3`,
+		`"code":2`,
+	)
+
+	var req coltracepb.ExportTraceServiceRequest
+	unmarshal(t, body, &req)
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans[0].Spans) != 1 {
+		t.Fatalf("request = %v, want a single span", &req)
+	}
+	rs := req.ResourceSpans[0]
+	if !proto.Equal(rs.Resource, resPB) {
+		t.Errorf("resource = %v, want %v", rs.Resource, resPB)
+	}
+	if scope := rs.ScopeSpans[0].Scope; scope.Name != "otelsql" || scope.Version != "0.1.0" {
+		t.Errorf("scope = %v, want otelsql 0.1.0", scope)
+	}
+	got := rs.ScopeSpans[0].Spans[0]
+	want := &tracepb.Span{
+		TraceId:           traceID[:],
+		SpanId:            spanID[:],
+		ParentSpanId:      parentSpanID[:],
+		Flags:             got.Flags, // set by the upstream transform
+		Name:              "SELECT pricing",
+		Kind:              tracepb.Span_SPAN_KIND_CLIENT,
+		StartTimeUnixNano: uint64(start.UnixNano()),
+		EndTimeUnixNano:   uint64(end.UnixNano()),
+		Attributes: []*commonpb.KeyValue{
+			{Key: "db.system.name", Value: str("sqlite")},
+			{Key: "db.response.returned_rows", Value: intValue(3)},
+			{Key: "error.flagged", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}}},
+			{Key: "ratio", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 0.5}}},
+			{Key: "tags", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{
+				Values: []*commonpb.AnyValue{str("a"), str("b")},
+			}}}},
+		},
+		Status: &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: "no such table"},
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("span = %v, want %v", got, want)
+	}
+}
+
+func TestResourceMetrics(t *testing.T) {
+	attrs := attribute.NewSet(attribute.String("http.route", "/pricing"))
+	attrsPB := []*commonpb.KeyValue{{Key: "http.route", Value: str("/pricing")}}
+	sum := 1.75
+	minV, maxV := 0.25, 1.5
+
+	rm := &metricdata.ResourceMetrics{
+		Resource: res,
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope: instrumentation.Scope{Name: "go-service", Version: "1.0.0", SchemaURL: "https://opentelemetry.io/schemas/1.37.0"},
+			Metrics: []metricdata.Metrics{
+				{
+					Name: "go.goroutine.count", Description: "Goroutines.", Unit: "{goroutine}",
+					Data: metricdata.Gauge[int64]{DataPoints: []metricdata.DataPoint[int64]{
+						{Time: end, Value: 12},
+					}},
+				},
+				{
+					Name: "pricing.revenue", Unit: "USD",
+					Data: metricdata.Sum[float64]{
+						Temporality: metricdata.CumulativeTemporality,
+						IsMonotonic: true,
+						DataPoints: []metricdata.DataPoint[float64]{
+							{Attributes: attrs, StartTime: start, Time: end, Value: 1999.98},
+						},
+					},
+				},
+				{
+					Name: "http.server.request.duration", Unit: "s",
+					Data: metricdata.Histogram[float64]{
+						Temporality: metricdata.DeltaTemporality,
+						DataPoints: []metricdata.HistogramDataPoint[float64]{{
+							Attributes: attrs, StartTime: start, Time: end,
+							Count: 3, Sum: sum, Bounds: []float64{0.5, 1}, BucketCounts: []uint64{1, 1, 1},
+							Min: metricdata.NewExtrema(minV), Max: metricdata.NewExtrema(maxV),
+							Exemplars: []metricdata.Exemplar[float64]{{
+								Time: end, Value: 1.5, TraceID: traceID[:], SpanID: spanID[:],
+								FilteredAttributes: []attribute.KeyValue{attribute.String("user", "demo")},
+							}},
+						}},
+					},
+				},
+				{
+					Name: "queue.size",
+					Data: metricdata.ExponentialHistogram[int64]{
+						Temporality: metricdata.CumulativeTemporality,
+						DataPoints: []metricdata.ExponentialHistogramDataPoint[int64]{{
+							StartTime: start, Time: end, Count: 4, Sum: 10, Scale: 2, ZeroCount: 1, ZeroThreshold: 0.001,
+							PositiveBucket: metricdata.ExponentialBucket{Offset: 3, Counts: []uint64{2, 1}},
+							NegativeBucket: metricdata.ExponentialBucket{Offset: -1, Counts: []uint64{}},
+						}},
+					},
+				},
+				{
+					Name: "legacy.latency",
+					Data: metricdata.Summary{DataPoints: []metricdata.SummaryDataPoint{{
+						StartTime: start, Time: end, Count: 2, Sum: 3,
+						QuantileValues: []metricdata.QuantileValue{{Quantile: 0.5, Value: 1}, {Quantile: 1, Value: 2}},
+					}}},
+				},
+			},
+		}},
+	}
+
+	got, err := ResourceMetrics(rm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	startNano, endNano := uint64(start.UnixNano()), uint64(end.UnixNano())
+	want := &metricpb.ResourceMetrics{
+		Resource: resPB,
+		ScopeMetrics: []*metricpb.ScopeMetrics{{
+			Scope:     &commonpb.InstrumentationScope{Name: "go-service", Version: "1.0.0"},
+			SchemaUrl: "https://opentelemetry.io/schemas/1.37.0",
+			Metrics: []*metricpb.Metric{
+				{
+					Name: "go.goroutine.count", Description: "Goroutines.", Unit: "{goroutine}",
+					Data: &metricpb.Metric_Gauge{Gauge: &metricpb.Gauge{DataPoints: []*metricpb.NumberDataPoint{
+						{TimeUnixNano: endNano, Value: &metricpb.NumberDataPoint_AsInt{AsInt: 12}},
+					}}},
+				},
+				{
+					Name: "pricing.revenue", Unit: "USD",
+					Data: &metricpb.Metric_Sum{Sum: &metricpb.Sum{
+						AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+						IsMonotonic:            true,
+						DataPoints: []*metricpb.NumberDataPoint{{
+							Attributes: attrsPB, StartTimeUnixNano: startNano, TimeUnixNano: endNano,
+							Value: &metricpb.NumberDataPoint_AsDouble{AsDouble: 1999.98},
+						}},
+					}},
+				},
+				{
+					Name: "http.server.request.duration", Unit: "s",
+					Data: &metricpb.Metric_Histogram{Histogram: &metricpb.Histogram{
+						AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+						DataPoints: []*metricpb.HistogramDataPoint{{
+							Attributes: attrsPB, StartTimeUnixNano: startNano, TimeUnixNano: endNano,
+							Count: 3, Sum: &sum, ExplicitBounds: []float64{0.5, 1}, BucketCounts: []uint64{1, 1, 1},
+							Min: &minV, Max: &maxV,
+							Exemplars: []*metricpb.Exemplar{{
+								TimeUnixNano: endNano, Value: &metricpb.Exemplar_AsDouble{AsDouble: 1.5},
+								TraceId: traceID[:], SpanId: spanID[:],
+								FilteredAttributes: []*commonpb.KeyValue{{Key: "user", Value: str("demo")}},
+							}},
+						}},
+					}},
+				},
+				{
+					Name: "queue.size",
+					Data: &metricpb.Metric_ExponentialHistogram{ExponentialHistogram: &metricpb.ExponentialHistogram{
+						AggregationTemporality: metricpb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+						DataPoints: []*metricpb.ExponentialHistogramDataPoint{{
+							StartTimeUnixNano: startNano, TimeUnixNano: endNano,
+							Count: 4, Sum: proto.Float64(10), Scale: 2, ZeroCount: 1, ZeroThreshold: 0.001,
+							Positive: &metricpb.ExponentialHistogramDataPoint_Buckets{Offset: 3, BucketCounts: []uint64{2, 1}},
+							Negative: &metricpb.ExponentialHistogramDataPoint_Buckets{Offset: -1},
+						}},
+					}},
+				},
+				{
+					Name: "legacy.latency",
+					Data: &metricpb.Metric_Summary{Summary: &metricpb.Summary{DataPoints: []*metricpb.SummaryDataPoint{{
+						StartTimeUnixNano: startNano, TimeUnixNano: endNano, Count: 2, Sum: 3,
+						QuantileValues: []*metricpb.SummaryDataPoint_ValueAtQuantile{{Quantile: 0.5, Value: 1}, {Quantile: 1, Value: 2}},
+					}}}},
+				},
+			},
+		}},
+	}
+	if !proto.Equal(got, want) {
+		t.Fatalf("ResourceMetrics = %v\nwant %v", got, want)
+	}
+
+	c := newCollector(t)
+	exp := NewMetricExporter(Config{URL: c.URL + "/v1/metrics"})
+	if err := exp.Export(context.Background(), rm); err != nil {
+		t.Fatal(err)
+	}
+	body := c.only(t)
+	wantJSON(t, body,
+		`"aggregationTemporality":1`,
+		`"aggregationTemporality":2`,
+		`"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+		`"spanId":"00f067aa0ba902b7"`,
+		`"asInt":"12"`,
+	)
+	var req colmetricpb.ExportMetricsServiceRequest
+	unmarshal(t, body, &req)
+	if len(req.ResourceMetrics) != 1 || !proto.Equal(req.ResourceMetrics[0], want) {
+		t.Errorf("exported = %v\nwant %v", &req, want)
+	}
+}
+
+func TestResourceMetricsUnsupported(t *testing.T) {
+	rm := &metricdata.ResourceMetrics{ScopeMetrics: []metricdata.ScopeMetrics{{
+		Metrics: []metricdata.Metrics{{Name: "bad"}}, // no Data
+	}}}
+	if _, err := ResourceMetrics(rm); err == nil {
+		t.Error("ResourceMetrics accepted a metric without data")
+	}
+}
+
+// recorder is an sdklog.Processor keeping the emitted records.
+type recorder struct {
+	records []sdklog.Record
+}
+
+func (r *recorder) OnEmit(_ context.Context, rec *sdklog.Record) error {
+	r.records = append(r.records, rec.Clone())
+	return nil
+}
+
+func (r *recorder) Enabled(context.Context, sdklog.EnabledParameters) bool { return true }
+func (r *recorder) Shutdown(context.Context) error                         { return nil }
+func (r *recorder) ForceFlush(context.Context) error                       { return nil }
+
+func TestResourceLogs(t *testing.T) {
+	rec := &recorder{}
+	lp := sdklog.NewLoggerProvider(sdklog.WithResource(res), sdklog.WithProcessor(rec))
+	defer lp.Shutdown(context.Background())
+
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled,
+	}))
+	emit := func(logger log.Logger, ctx context.Context, sev log.Severity, body log.Value, attrs ...log.KeyValue) {
+		var r log.Record
+		r.SetTimestamp(start)
+		r.SetObservedTimestamp(end)
+		r.SetSeverity(sev)
+		r.SetSeverityText(sev.String())
+		r.SetBody(body)
+		r.AddAttributes(attrs...)
+		logger.Emit(ctx, r)
+	}
+	service := lp.Logger("go-service-logger", log.WithInstrumentationVersion("1.0.0"))
+	db := lp.Logger("otelsql")
+	emit(service, ctx, log.SeverityInfo, log.StringValue("Pricing calculated"),
+		log.Int64("quantity", 2),
+		log.Float64("total", 1999.98),
+		log.Bool("notified", true),
+		log.Bytes("raw", []byte{0xca, 0xfe}),
+		log.Slice("items", log.StringValue("Laptop")),
+		log.Map("request", log.String("product_name", "Laptop")),
+	)
+	emit(db, context.Background(), log.SeverityError, log.StringValue("no such table"))
+	emit(service, context.Background(), log.SeverityWarn, log.MapValue(log.String("event", "retry")))
+
+	got := ResourceLogs(rec.records)
+	startNano, endNano := uint64(start.UnixNano()), uint64(end.UnixNano())
+	want := []*logpb.ResourceLogs{{
+		Resource: resPB,
+		ScopeLogs: []*logpb.ScopeLogs{
+			{
+				Scope: &commonpb.InstrumentationScope{Name: "go-service-logger", Version: "1.0.0"},
+				LogRecords: []*logpb.LogRecord{
+					{
+						TimeUnixNano: startNano, ObservedTimeUnixNano: endNano,
+						SeverityNumber: logpb.SeverityNumber_SEVERITY_NUMBER_INFO, SeverityText: "INFO",
+						Body: str("Pricing calculated"),
+						Attributes: []*commonpb.KeyValue{
+							{Key: "quantity", Value: intValue(2)},
+							{Key: "total", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: 1999.98}}},
+							{Key: "notified", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: true}}},
+							{Key: "raw", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: []byte{0xca, 0xfe}}}},
+							{Key: "items", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{
+								Values: []*commonpb.AnyValue{str("Laptop")},
+							}}}},
+							{Key: "request", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{
+								Values: []*commonpb.KeyValue{{Key: "product_name", Value: str("Laptop")}},
+							}}}},
+						},
+						Flags:   uint32(trace.FlagsSampled),
+						TraceId: traceID[:],
+						SpanId:  spanID[:],
+					},
+					{
+						TimeUnixNano: startNano, ObservedTimeUnixNano: endNano,
+						SeverityNumber: logpb.SeverityNumber_SEVERITY_NUMBER_WARN, SeverityText: "WARN",
+						Body: &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{
+							Values: []*commonpb.KeyValue{{Key: "event", Value: str("retry")}},
+						}}},
+					},
+				},
+			},
+			{
+				Scope: &commonpb.InstrumentationScope{Name: "otelsql"},
+				LogRecords: []*logpb.LogRecord{{
+					TimeUnixNano: startNano, ObservedTimeUnixNano: endNano,
+					SeverityNumber: logpb.SeverityNumber_SEVERITY_NUMBER_ERROR, SeverityText: "ERROR",
+					Body: str("no such table"),
+				}},
+			},
+		},
+	}}
+	if len(got) != len(want) || !proto.Equal(got[0], want[0]) {
+		t.Fatalf("ResourceLogs = %v\nwant %v", got, want)
+	}
+
+	c := newCollector(t)
+	exp := NewLogExporter(Config{URL: c.URL + "/v1/logs"})
+	if err := exp.Export(context.Background(), rec.records); err != nil {
+		t.Fatal(err)
+	}
+	body := c.only(t)
+	wantJSON(t, body,
+		`"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+		`"spanId":"00f067aa0ba902b7"`,
+		`"severityNumber":9`,
+		`"severityNumber":17`,
+	)
+	var req collogpb.ExportLogsServiceRequest
+	unmarshal(t, body, &req)
+	if len(req.ResourceLogs) != 1 || !proto.Equal(req.ResourceLogs[0], want[0]) {
+		t.Errorf("exported = %v\nwant %v", &req, want[0])
+	}
+}
+
+func TestExportError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	exp := NewLogExporter(Config{URL: srv.URL + "/v1/logs"})
+	var r sdklog.Record
+	r.SetBody(log.StringValue("lost"))
+	if err := exp.Export(context.Background(), []sdklog.Record{r}); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Export = %v, want the collector's 503", err)
+	}
+}
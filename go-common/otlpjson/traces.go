@@ -0,0 +1,33 @@
+package otlpjson
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+type traceClient struct {
+	c *client
+}
+
+// NewTraceClient returns an otlptrace.Client posting spans as OTLP/JSON.
+// Wrap it with otlptrace.New to get a SpanExporter.
+func NewTraceClient(cfg Config) otlptrace.Client {
+	return &traceClient{c: newClient(cfg)}
+}
+
+func (t *traceClient) Start(context.Context) error { return nil }
+
+func (t *traceClient) Stop(context.Context) error {
+	t.c.close()
+	return nil
+}
+
+func (t *traceClient) UploadTraces(ctx context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	if len(protoSpans) == 0 {
+		return nil
+	}
+	return t.c.post(ctx, &coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans})
+}
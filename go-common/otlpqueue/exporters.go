@@ -0,0 +1,122 @@
+package otlpqueue
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	collogpb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	metricpb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+
+	"github.com/nutslove/otel-instrumentation-demo/go-common/otlpjson"
+)
+
+// The exporters below return as soon as the request is on disk, so
+// ForceFlush has nothing to wait for. Shutdown shuts the queue down.
+
+type traceClient struct {
+	q *Queue
+}
+
+// TraceClient returns an otlptrace.Client queueing spans in q. Wrap it with
+// otlptrace.New to get a SpanExporter.
+func (q *Queue) TraceClient() otlptrace.Client {
+	return &traceClient{q: q}
+}
+
+func (c *traceClient) Start(context.Context) error { return nil }
+
+func (c *traceClient) Stop(ctx context.Context) error { return c.q.Shutdown(ctx) }
+
+func (c *traceClient) UploadTraces(_ context.Context, protoSpans []*tracepb.ResourceSpans) error {
+	var spans int
+	for _, rs := range protoSpans {
+		for _, ss := range rs.ScopeSpans {
+			spans += len(ss.Spans)
+		}
+	}
+	return c.q.enqueue(&coltracepb.ExportTraceServiceRequest{ResourceSpans: protoSpans}, spans)
+}
+
+// MetricExporter queues metrics. It uses the SDK's default temporality and
+// aggregation selectors, like the OTLP/HTTP exporter.
+type MetricExporter struct {
+	q *Queue
+}
+
+var _ sdkmetric.Exporter = (*MetricExporter)(nil)
+
+// MetricExporter returns a MetricExporter queueing in q, for use with a
+// PeriodicReader.
+func (q *Queue) MetricExporter() *MetricExporter {
+	return &MetricExporter{q: q}
+}
+
+func (e *MetricExporter) Temporality(k sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(k)
+}
+
+func (e *MetricExporter) Aggregation(k sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(k)
+}
+
+func (e *MetricExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	pb, err := otlpjson.ResourceMetrics(rm)
+	if err != nil {
+		return err
+	}
+	return e.q.enqueue(&colmetricpb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricpb.ResourceMetrics{pb},
+	}, dataPoints(pb))
+}
+
+func (e *MetricExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *MetricExporter) Shutdown(ctx context.Context) error { return e.q.Shutdown(ctx) }
+
+func dataPoints(rm *metricpb.ResourceMetrics) int {
+	var n int
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch d := m.Data.(type) {
+			case *metricpb.Metric_Gauge:
+				n += len(d.Gauge.DataPoints)
+			case *metricpb.Metric_Sum:
+				n += len(d.Sum.DataPoints)
+			case *metricpb.Metric_Histogram:
+				n += len(d.Histogram.DataPoints)
+			case *metricpb.Metric_ExponentialHistogram:
+				n += len(d.ExponentialHistogram.DataPoints)
+			case *metricpb.Metric_Summary:
+				n += len(d.Summary.DataPoints)
+			}
+		}
+	}
+	return n
+}
+
+// LogExporter queues log records.
+type LogExporter struct {
+	q *Queue
+}
+
+var _ sdklog.Exporter = (*LogExporter)(nil)
+
+// LogExporter returns a LogExporter queueing in q, for use with a
+// BatchProcessor.
+func (q *Queue) LogExporter() *LogExporter {
+	return &LogExporter{q: q}
+}
+
+func (e *LogExporter) Export(_ context.Context, records []sdklog.Record) error {
+	return e.q.enqueue(&collogpb.ExportLogsServiceRequest{ResourceLogs: otlpjson.ResourceLogs(records)}, len(records))
+}
+
+func (e *LogExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *LogExporter) Shutdown(ctx context.Context) error { return e.q.Shutdown(ctx) }
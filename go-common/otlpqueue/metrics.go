@@ -0,0 +1,67 @@
+package otlpqueue
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "github.com/nutslove/otel-instrumentation-demo/go-common/otlpqueue"
+
+// RegisterMetrics records the state of queues on mp, observed at every
+// collection and broken down by signal:
+//
+//   - otlpqueue.items and otlpqueue.size: items and bytes waiting on disk
+//   - otlpqueue.exported: items the collector accepted
+//   - otlpqueue.dropped{reason=queue_full|rejected|io_error}: items given up
+//
+// Items are spans, metric data points or log records.
+func RegisterMetrics(mp metric.MeterProvider, queues ...*Queue) error {
+	meter := mp.Meter(instrumentationName)
+
+	items, err := meter.Int64ObservableUpDownCounter("otlpqueue.items",
+		metric.WithDescription("Number of items waiting in the export queue."),
+		metric.WithUnit("{item}"),
+	)
+	if err != nil {
+		return err
+	}
+	size, err := meter.Int64ObservableUpDownCounter("otlpqueue.size",
+		metric.WithDescription("Disk space used by the export queue."),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		return err
+	}
+	exported, err := meter.Int64ObservableCounter("otlpqueue.exported",
+		metric.WithDescription("Number of queued items accepted by the collector."),
+		metric.WithUnit("{item}"),
+	)
+	if err != nil {
+		return err
+	}
+	dropped, err := meter.Int64ObservableCounter("otlpqueue.dropped",
+		metric.WithDescription("Number of items dropped instead of exported."),
+		metric.WithUnit("{item}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, q := range queues {
+			signal := attribute.String("signal", q.signal)
+			q.mu.Lock()
+			o.ObserveInt64(items, q.items, metric.WithAttributes(signal))
+			o.ObserveInt64(size, q.size, metric.WithAttributes(signal))
+			o.ObserveInt64(exported, q.exported, metric.WithAttributes(signal))
+			for reason, n := range q.dropped {
+				o.ObserveInt64(dropped, n, metric.WithAttributes(signal, attribute.String("reason", reason)))
+			}
+			q.mu.Unlock()
+		}
+		return nil
+	}, items, size, exported, dropped)
+	return err
+}
@@ -0,0 +1,454 @@
+// Package otlpqueue puts a persistent, file-backed queue in front of the
+// OTLP exporters. Exporting only writes the encoded export request to a
+// directory; a background sender posts the files to the collector over
+// OTLP/HTTP in order, retries with exponential backoff while the collector
+// is unreachable and deletes each file once it is accepted. What is still
+// queued at shutdown is sent after the next start, so neither a collector
+// restart nor a service restart during a collector outage loses data.
+//
+// Each signal needs a Queue, and a directory, of its own. The directory
+// must not be shared between processes.
+package otlpqueue
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	collogpb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/nutslove/otel-instrumentation-demo/go-common/otlpjson"
+)
+
+// Signals, as used in the sub-directory and the signal metric attribute.
+const (
+	Traces  = "traces"
+	Metrics = "metrics"
+	Logs    = "logs"
+)
+
+// DefaultMaxBytes bounds a queue's directory when Config.MaxBytes is zero.
+const DefaultMaxBytes = 64 << 20
+
+// Retry backoff: doubled after each failed attempt up to maxBackoff, with
+// up to half of it taken off at random so that restarted services do not
+// retry in step. Variables, so that the tests can shorten them.
+var (
+	initialBackoff = time.Second
+	maxBackoff     = 30 * time.Second
+)
+
+// Reasons for dropped items, as in the reason metric attribute.
+const (
+	reasonQueueFull = "queue_full"
+	reasonRejected  = "rejected"
+	reasonIOError   = "io_error"
+)
+
+// Config configures a Queue.
+type Config struct {
+	// Dir holds the queued requests; it is created when missing.
+	Dir string
+	// MaxBytes bounds the size of Dir (default DefaultMaxBytes). Exports
+	// that do not fit are dropped, the queued data is kept.
+	MaxBytes int64
+	// Target is where the requests are posted, e.g.
+	// http://otel-collector:4318/v1/traces.
+	Target otlpjson.Config
+	// JSON posts OTLP/JSON (http/json) instead of protobuf.
+	JSON bool
+}
+
+// Queue stores the export requests of one signal and sends them on.
+type Queue struct {
+	signal   string
+	cfg      Config
+	http     *http.Client
+	newReq   func() proto.Message
+	wake     chan struct{}
+	drain    chan struct{}
+	done     chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopOnce sync.Once
+
+	mu       sync.Mutex
+	files    []file
+	seq      uint64
+	items    int64
+	size     int64
+	exported int64
+	dropped  map[string]int64
+	closed   bool
+}
+
+// file is a queued export request, named "<seq>-<items>.pb". The number of
+// spans, data points or log records is kept in the name so that the queue
+// metrics survive a restart without decoding the files.
+type file struct {
+	name  string
+	items int64
+	size  int64
+}
+
+// New opens the queue of signal (Traces, Metrics or Logs) in cfg.Dir,
+// picks up the requests left there by a previous run and starts sending.
+func New(signal string, cfg Config) (*Queue, error) {
+	var newReq func() proto.Message
+	switch signal {
+	case Traces:
+		newReq = func() proto.Message { return &coltracepb.ExportTraceServiceRequest{} }
+	case Metrics:
+		newReq = func() proto.Message { return &colmetricpb.ExportMetricsServiceRequest{} }
+	case Logs:
+		newReq = func() proto.Message { return &collogpb.ExportLogsServiceRequest{} }
+	default:
+		return nil, fmt.Errorf("otlpqueue: unknown signal %q", signal)
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = DefaultMaxBytes
+	}
+	if cfg.Target.Timeout <= 0 {
+		cfg.Target.Timeout = otlpjson.DefaultTimeout
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("otlpqueue: failed to create %s: %w", cfg.Dir, err)
+	}
+
+	q := &Queue{
+		signal:  signal,
+		cfg:     cfg,
+		http:    &http.Client{},
+		newReq:  newReq,
+		wake:    make(chan struct{}, 1),
+		drain:   make(chan struct{}),
+		done:    make(chan struct{}),
+		dropped: map[string]int64{},
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	go q.run()
+	return q, nil
+}
+
+// load restores the queue from the files in cfg.Dir, oldest first.
+// Partially written files from an interrupted run are removed.
+func (q *Queue) load() error {
+	entries, err := os.ReadDir(q.cfg.Dir)
+	if err != nil {
+		return fmt.Errorf("otlpqueue: failed to read %s: %w", q.cfg.Dir, err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			os.Remove(filepath.Join(q.cfg.Dir, e.Name()))
+			continue
+		}
+		seq, items, ok := parseName(e.Name())
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		q.files = append(q.files, file{name: e.Name(), items: items, size: info.Size()})
+		q.items += items
+		q.size += info.Size()
+		q.seq = max(q.seq, seq+1)
+	}
+	// The sequence number is zero-padded, so names sort in queue order.
+	sort.Slice(q.files, func(i, j int) bool { return q.files[i].name < q.files[j].name })
+	return nil
+}
+
+func parseName(name string) (seq uint64, items int64, ok bool) {
+	base, found := strings.CutSuffix(name, ".pb")
+	if !found {
+		return 0, 0, false
+	}
+	s, n, found := strings.Cut(base, "-")
+	if !found {
+		return 0, 0, false
+	}
+	seq, err1 := strconv.ParseUint(s, 10, 64)
+	items, err2 := strconv.ParseInt(n, 10, 64)
+	return seq, items, err1 == nil && err2 == nil
+}
+
+// enqueue writes msg, carrying the given number of items, to the queue.
+func (q *Queue) enqueue(msg proto.Message, items int) error {
+	if items == 0 {
+		return nil
+	}
+	body, err := proto.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("otlpqueue: failed to marshal request: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return fmt.Errorf("otlpqueue: %s queue is shut down", q.signal)
+	}
+	if q.size+int64(len(body)) > q.cfg.MaxBytes {
+		q.dropped[reasonQueueFull] += int64(items)
+		return fmt.Errorf("otlpqueue: %s queue is full (%d bytes), dropped %d items", q.signal, q.size, items)
+	}
+
+	name := fmt.Sprintf("%020d-%d.pb", q.seq, items)
+	path := filepath.Join(q.cfg.Dir, name)
+	if err := q.write(path, body); err != nil {
+		q.dropped[reasonIOError] += int64(items)
+		return fmt.Errorf("otlpqueue: failed to write %s: %w", path, err)
+	}
+	q.seq++
+	q.files = append(q.files, file{name: name, items: int64(items), size: int64(len(body))})
+	q.items += int64(items)
+	q.size += int64(len(body))
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// write stores body as path. The data and the directory entry of the
+// temporary file are synced before the rename, and the directory again
+// after it, so that a crash or power loss leaves either no file or the
+// complete request under a queue name.
+func (q *Queue) write(path string, body []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(body)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = syncDir(q.cfg.Dir)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := syncDir(q.cfg.Dir); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// run sends the queued files one at a time, oldest first, until Shutdown.
+func (q *Queue) run() {
+	defer close(q.done)
+
+	failures := 0
+	for {
+		f, ok := q.head()
+		if !ok {
+			select {
+			case <-q.wake:
+				continue
+			case <-q.drain:
+				return
+			case <-q.ctx.Done():
+				return
+			}
+		}
+
+		retryAfter, err := q.send(f)
+		var rejected *rejectedError
+		switch {
+		case err == nil:
+			q.remove(f, "")
+			failures = 0
+			continue
+		case errors.As(err, &rejected):
+			// The collector will never accept this request; retrying
+			// would block the queue.
+			otel.Handle(err)
+			q.remove(f, reasonRejected)
+			failures = 0
+			continue
+		}
+
+		if failures == 0 {
+			otel.Handle(fmt.Errorf("%w; keeping %s queued and retrying", err, q.signal))
+		}
+		wait := backoff(failures)
+		failures++
+		if retryAfter > wait {
+			wait = min(retryAfter, maxBackoff)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-q.drain:
+			// Still failing at shutdown: leave the rest for the next start.
+			timer.Stop()
+			return
+		case <-q.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func backoff(failures int) time.Duration {
+	d := maxBackoff
+	if failures < 5 {
+		d = min(initialBackoff<<failures, maxBackoff)
+	}
+	return d - rand.N(d/2)
+}
+
+func (q *Queue) head() (file, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.files) == 0 {
+		return file{}, false
+	}
+	return q.files[0], true
+}
+
+// remove deletes the head of the queue after it was sent (reason empty) or
+// dropped.
+func (q *Queue) remove(f file, reason string) {
+	if err := os.Remove(filepath.Join(q.cfg.Dir, f.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		otel.Handle(fmt.Errorf("otlpqueue: failed to remove %s: %w", f.name, err))
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.files = q.files[1:]
+	q.items -= f.items
+	q.size -= f.size
+	if reason == "" {
+		q.exported += f.items
+	} else {
+		q.dropped[reason] += f.items
+	}
+}
+
+// rejectedError is a response the request must not be retried after.
+type rejectedError struct {
+	err error
+}
+
+func (e *rejectedError) Error() string { return e.err.Error() }
+func (e *rejectedError) Unwrap() error { return e.err }
+
+// send posts f. Failures worth retrying are returned as they are, together
+// with the delay the collector asked for, if any; everything else is a
+// *rejectedError.
+func (q *Queue) send(f file) (time.Duration, error) {
+	body, err := os.ReadFile(filepath.Join(q.cfg.Dir, f.name))
+	if err != nil {
+		return 0, &rejectedError{fmt.Errorf("otlpqueue: failed to read %s: %w", f.name, err)}
+	}
+	contentType := "application/x-protobuf"
+	if q.cfg.JSON {
+		msg := q.newReq()
+		if err := proto.Unmarshal(body, msg); err != nil {
+			return 0, &rejectedError{fmt.Errorf("otlpqueue: failed to decode %s: %w", f.name, err)}
+		}
+		if body, err = otlpjson.Marshal(msg); err != nil {
+			return 0, &rejectedError{fmt.Errorf("otlpqueue: failed to encode %s: %w", f.name, err)}
+		}
+		contentType = "application/json"
+	}
+
+	ctx, cancel := context.WithTimeout(q.ctx, q.cfg.Target.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, q.cfg.Target.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, &rejectedError{fmt.Errorf("otlpqueue: failed to create request: %w", err)}
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range q.cfg.Target.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := q.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("otlpqueue: failed to send to %s: %w", q.cfg.Target.URL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode == http.StatusBadGateway,
+		resp.StatusCode == http.StatusServiceUnavailable, resp.StatusCode == http.StatusGatewayTimeout:
+		// The statuses the OTLP specification marks as retryable
+		var retryAfter time.Duration
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s > 0 {
+			retryAfter = time.Duration(s) * time.Second
+		}
+		return retryAfter, fmt.Errorf("otlpqueue: %s responded with %s", q.cfg.Target.URL, resp.Status)
+	default:
+		return 0, &rejectedError{fmt.Errorf("otlpqueue: %s rejected %s with %s", q.cfg.Target.URL, f.name, resp.Status)}
+	}
+}
+
+// Shutdown stops accepting exports and keeps sending until the queue is
+// empty, the collector fails or ctx is done. Whatever is left stays on disk
+// for the next start.
+func (q *Queue) Shutdown(ctx context.Context) error {
+	q.stopOnce.Do(func() {
+		q.mu.Lock()
+		q.closed = true
+		q.mu.Unlock()
+		close(q.drain)
+	})
+
+	var err error
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	q.cancel()
+	<-q.done
+	q.http.CloseIdleConnections()
+	return err
+}
@@ -0,0 +1,364 @@
+package otlpqueue
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/nutslove/otel-instrumentation-demo/go-common/otlpjson"
+)
+
+// collector stands in for the Collector's OTLP/HTTP traces receiver. It
+// answers with the scripted responses first, then with 200.
+type collector struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	responses []response
+	// requests are the arrival times of all requests, accepted or not.
+	requests []time.Time
+	accepted []*coltracepb.ExportTraceServiceRequest
+}
+
+type response struct {
+	status     int
+	retryAfter string
+}
+
+func newCollector(t *testing.T, responses ...response) *collector {
+	t.Helper()
+	c := &collector{responses: responses}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-protobuf" {
+			t.Errorf("Content-Type = %q, want application/x-protobuf", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.requests = append(c.requests, time.Now())
+		if len(c.responses) > 0 {
+			resp := c.responses[0]
+			c.responses = c.responses[1:]
+			if resp.retryAfter != "" {
+				w.Header().Set("Retry-After", resp.retryAfter)
+			}
+			w.WriteHeader(resp.status)
+			return
+		}
+		req := &coltracepb.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(body, req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		c.accepted = append(c.accepted, req)
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *collector) state() (requests []time.Time, accepted []*coltracepb.ExportTraceServiceRequest) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Time(nil), c.requests...), append([]*coltracepb.ExportTraceServiceRequest(nil), c.accepted...)
+}
+
+// newQueue opens a traces queue in dir posting to url, shut down at the end
+// of the test.
+func newQueue(t *testing.T, dir, url string, maxBytes int64) *Queue {
+	t.Helper()
+	q, err := New(Traces, Config{Dir: dir, MaxBytes: maxBytes, Target: otlpjson.Config{URL: url}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { shutdown(t, q) })
+	return q
+}
+
+func shutdown(t *testing.T, q *Queue) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := q.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() = %v", err)
+	}
+}
+
+// fastBackoff shortens the retry backoff for the test.
+func fastBackoff(t *testing.T) {
+	initial, maximum := initialBackoff, maxBackoff
+	initialBackoff, maxBackoff = 10*time.Millisecond, 100*time.Millisecond
+	t.Cleanup(func() { initialBackoff, maxBackoff = initial, maximum })
+}
+
+// spans returns an export request with n spans named "<name>-<i>".
+func spans(name string, n int) *coltracepb.ExportTraceServiceRequest {
+	ss := &tracepb.ScopeSpans{}
+	for i := range n {
+		ss.Spans = append(ss.Spans, &tracepb.Span{
+			TraceId: []byte("0123456789abcdef"),
+			SpanId:  []byte("01234567"),
+			Name:    fmt.Sprintf("%s-%d", name, i),
+		})
+	}
+	return &coltracepb.ExportTraceServiceRequest{
+		ResourceSpans: []*tracepb.ResourceSpans{{ScopeSpans: []*tracepb.ScopeSpans{ss}}},
+	}
+}
+
+func upload(t *testing.T, q *Queue, req *coltracepb.ExportTraceServiceRequest) {
+	t.Helper()
+	if err := q.TraceClient().UploadTraces(context.Background(), req.ResourceSpans); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stats returns the counters of q.
+func stats(q *Queue) (items, exported int64, dropped map[string]int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	dropped = make(map[string]int64)
+	for reason, n := range q.dropped {
+		dropped[reason] = n
+	}
+	return q.items, q.exported, dropped
+}
+
+// queued returns the names of the files in dir.
+func queued(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+// waitFor polls cond until it holds or the test has waited too long.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	c := newCollector(t)
+	dir := t.TempDir()
+	q := newQueue(t, dir, c.URL, 0)
+
+	req := spans("enqueue", 3)
+	upload(t, q, req)
+	waitFor(t, "the request to be exported", func() bool {
+		_, exported, _ := stats(q)
+		return exported == 3
+	})
+
+	if _, accepted := c.state(); len(accepted) != 1 || !proto.Equal(accepted[0], req) {
+		t.Errorf("collector received %v, want %v", accepted, req)
+	}
+	if items, _, dropped := stats(q); items != 0 || len(dropped) != 0 {
+		t.Errorf("items = %d, dropped = %v after export, want none", items, dropped)
+	}
+	if names := queued(t, dir); len(names) != 0 {
+		t.Errorf("files left after export: %v", names)
+	}
+
+	// Requests without items are not queued.
+	upload(t, q, &coltracepb.ExportTraceServiceRequest{})
+	if names := queued(t, dir); len(names) != 0 {
+		t.Errorf("empty request queued: %v", names)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	fastBackoff(t)
+	// The collector is down, the first request stays queued.
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	dir := t.TempDir()
+
+	first := spans("first", 2)
+	body, err := proto.Marshal(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := newQueue(t, dir, down.URL, int64(len(body))+10)
+
+	upload(t, q, first)
+	err = q.TraceClient().UploadTraces(context.Background(), spans("second", 3).ResourceSpans)
+	if err == nil || !strings.Contains(err.Error(), "queue is full") {
+		t.Fatalf("UploadTraces() over MaxBytes = %v, want a queue full error", err)
+	}
+
+	items, _, dropped := stats(q)
+	if items != 2 {
+		t.Errorf("items = %d, want the 2 of the first request", items)
+	}
+	if want := map[string]int64{reasonQueueFull: 3}; fmt.Sprint(dropped) != fmt.Sprint(want) {
+		t.Errorf("dropped = %v, want %v", dropped, want)
+	}
+	if names := queued(t, dir); len(names) != 1 || names[0] != fmt.Sprintf("%020d-2.pb", 0) {
+		t.Errorf("queued files = %v, want the first request only", names)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for failures := range 8 {
+		d := min(initialBackoff<<failures, maxBackoff)
+		for range 100 {
+			if got := backoff(failures); got <= d/2 || got > d {
+				t.Fatalf("backoff(%d) = %s, want in (%s, %s]", failures, got, d/2, d)
+			}
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	fastBackoff(t)
+	c := newCollector(t,
+		response{status: http.StatusServiceUnavailable},
+		response{status: http.StatusBadGateway},
+		response{status: http.StatusGatewayTimeout},
+	)
+	q := newQueue(t, t.TempDir(), c.URL, 0)
+
+	req := spans("retry", 1)
+	upload(t, q, req)
+	waitFor(t, "the request to be exported", func() bool {
+		_, exported, _ := stats(q)
+		return exported == 1
+	})
+
+	requests, accepted := c.state()
+	if len(requests) != 4 {
+		t.Fatalf("collector got %d requests, want 3 failed and 1 accepted", len(requests))
+	}
+	for i := 1; i < len(requests); i++ {
+		// The i-th retry waits backoff(i-1), at least half its nominal value.
+		if gap, want := requests[i].Sub(requests[i-1]), (initialBackoff<<(i-1))/2; gap < want {
+			t.Errorf("retry %d after %s, want at least %s", i, gap, want)
+		}
+	}
+	if len(accepted) != 1 || !proto.Equal(accepted[0], req) {
+		t.Errorf("collector accepted %v, want %v", accepted, req)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	fastBackoff(t)
+	maxBackoff = 5 * time.Second
+	c := newCollector(t, response{status: http.StatusTooManyRequests, retryAfter: "1"})
+	q := newQueue(t, t.TempDir(), c.URL, 0)
+
+	upload(t, q, spans("retry-after", 1))
+	waitFor(t, "the request to be exported", func() bool {
+		_, exported, _ := stats(q)
+		return exported == 1
+	})
+
+	requests, _ := c.state()
+	if len(requests) != 2 {
+		t.Fatalf("collector got %d requests, want 2", len(requests))
+	}
+	if gap := requests[1].Sub(requests[0]); gap < time.Second {
+		t.Errorf("retried after %s, want the 1s of Retry-After", gap)
+	}
+}
+
+func TestDropRejected(t *testing.T) {
+	fastBackoff(t)
+	c := newCollector(t, response{status: http.StatusBadRequest})
+	dir := t.TempDir()
+	q := newQueue(t, dir, c.URL, 0)
+
+	upload(t, q, spans("rejected", 2))
+	second := spans("accepted", 1)
+	upload(t, q, second)
+	waitFor(t, "both requests to be handled", func() bool {
+		items, _, _ := stats(q)
+		return items == 0
+	})
+
+	requests, accepted := c.state()
+	if len(requests) != 2 {
+		t.Errorf("collector got %d requests, want 2: a 4xx is not retried", len(requests))
+	}
+	if len(accepted) != 1 || !proto.Equal(accepted[0], second) {
+		t.Errorf("collector accepted %v, want %v", accepted, second)
+	}
+	_, exported, dropped := stats(q)
+	if exported != 1 || dropped[reasonRejected] != 2 {
+		t.Errorf("exported = %d, dropped = %v, want 1 exported and 2 rejected", exported, dropped)
+	}
+	if names := queued(t, dir); len(names) != 0 {
+		t.Errorf("files left: %v", names)
+	}
+}
+
+func TestReplayAfterRestart(t *testing.T) {
+	fastBackoff(t)
+	dir := t.TempDir()
+
+	// First run: the collector is down, shutting down leaves the queue on
+	// disk, along with a request whose write was interrupted.
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	q, err := New(Traces, Config{Dir: dir, Target: otlpjson.Config{URL: down.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := spans("first", 1), spans("second", 2)
+	upload(t, q, first)
+	upload(t, q, second)
+	shutdown(t, q)
+	if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%020d-1.pb.tmp", 2)), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if names := queued(t, dir); len(names) != 3 {
+		t.Fatalf("files after shutdown = %v, want 2 requests and the partial one", names)
+	}
+
+	// Second run: the queued requests go out first, in order.
+	c := newCollector(t)
+	q = newQueue(t, dir, c.URL, 0)
+	third := spans("third", 1)
+	upload(t, q, third)
+	waitFor(t, "the queue to be exported", func() bool {
+		_, exported, _ := stats(q)
+		return exported == 4
+	})
+
+	_, accepted := c.state()
+	want := []*coltracepb.ExportTraceServiceRequest{first, second, third}
+	if len(accepted) != len(want) {
+		t.Fatalf("collector accepted %d requests, want %d", len(accepted), len(want))
+	}
+	for i := range want {
+		if !proto.Equal(accepted[i], want[i]) {
+			t.Errorf("request %d = %v, want %v", i, accepted[i], want[i])
+		}
+	}
+	if names := queued(t, dir); len(names) != 0 {
+		t.Errorf("files left: %v", names)
+	}
+}
@@ -0,0 +1,225 @@
+// Package propcheck measures how often a service loses the trace of the
+// requests it handles. A Checker's Handler classifies every inbound request
+// by its trace context, and Transport compares it with the context sent on
+// the outgoing requests made while handling it:
+//
+//   - valid_parent: a valid W3C traceparent, continued downstream
+//   - b3_only: no valid traceparent but B3 headers, continued downstream
+//   - no_context: no trace context at all
+//   - mismatch: a trace context the outgoing requests did not carry on,
+//     because they had another trace ID or none
+//
+// Requests without outgoing calls are classified by their headers alone.
+// The counts are recorded as propagation.requests{class} and served as a
+// JSON summary by the Checker itself:
+//
+//	checker, _ := propcheck.New(propcheck.Config{Exclude: []string{"/health"}})
+//	r.GET("/debug/propagation", gin.WrapH(checker))
+//	srv := &http.Server{Handler: checker.Handler(r)}
+//	client := &http.Client{Transport: otelhttp.NewTransport(&propcheck.Transport{})}
+package propcheck
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/nutslove/otel-instrumentation-demo/go-common/propcheck"
+
+// Class is the propagation class of an inbound request.
+type Class string
+
+const (
+	ClassValidParent Class = "valid_parent"
+	ClassB3Only      Class = "b3_only"
+	ClassNoContext   Class = "no_context"
+	ClassMismatch    Class = "mismatch"
+)
+
+// Classes lists every Class in the order of the summary.
+var Classes = []Class{ClassValidParent, ClassB3Only, ClassNoContext, ClassMismatch}
+
+var (
+	traceContext = propagation.TraceContext{}
+	b3Propagator = b3.New()
+)
+
+// Config configures a Checker.
+type Config struct {
+	// Exclude lists the paths not classified, such as health checks; an
+	// entry ending in "/" covers every path below it. CORS preflights are
+	// never classified, browsers send them without trace headers.
+	Exclude []string
+	// MeterProvider records propagation.requests (the global one when nil).
+	MeterProvider metric.MeterProvider
+}
+
+// Checker classifies inbound requests and keeps their counts.
+type Checker struct {
+	exclude  []string
+	requests metric.Int64Counter
+
+	mu     sync.Mutex
+	since  time.Time
+	counts map[Class]int64
+}
+
+// New returns a Checker for cfg.
+func New(cfg Config) (*Checker, error) {
+	mp := cfg.MeterProvider
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	requests, err := mp.Meter(instrumentationName).Int64Counter("propagation.requests",
+		metric.WithDescription("Number of inbound requests by how their trace context was propagated."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &Checker{
+		exclude:  cfg.Exclude,
+		requests: requests,
+		since:    time.Now(),
+		counts:   make(map[Class]int64),
+	}, nil
+}
+
+func (c *Checker) excluded(r *http.Request) bool {
+	if r.Method == http.MethodOptions {
+		return true
+	}
+	for _, e := range c.exclude {
+		if r.URL.Path == e || strings.HasSuffix(e, "/") && strings.HasPrefix(r.URL.Path, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler classifies the requests served by next. It must wrap the whole
+// handler, so that the outgoing requests of next are seen by Transport.
+func (c *Checker) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.excluded(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		class, traceID := inbound(r.Header)
+		st := &state{traceID: traceID}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), stateKey{}, st)))
+
+		st.mu.Lock()
+		if st.broken {
+			class = ClassMismatch
+		}
+		st.mu.Unlock()
+		c.record(r.Context(), class)
+	})
+}
+
+func (c *Checker) record(ctx context.Context, class Class) {
+	c.requests.Add(ctx, 1, metric.WithAttributes(attribute.String("class", string(class))))
+	c.mu.Lock()
+	c.counts[class]++
+	c.mu.Unlock()
+}
+
+// inbound returns the class of a request with headers h before its
+// outgoing requests are seen, and its trace ID if it has one.
+func inbound(h http.Header) (Class, trace.TraceID) {
+	carrier := propagation.HeaderCarrier(h)
+	if sc := trace.SpanContextFromContext(traceContext.Extract(context.Background(), carrier)); sc.IsValid() {
+		return ClassValidParent, sc.TraceID()
+	}
+	if sc := trace.SpanContextFromContext(b3Propagator.Extract(context.Background(), carrier)); sc.IsValid() {
+		return ClassB3Only, sc.TraceID()
+	}
+	return ClassNoContext, trace.TraceID{}
+}
+
+// state is the propagation state of a request being handled.
+type state struct {
+	traceID trace.TraceID
+
+	mu     sync.Mutex
+	broken bool
+}
+
+type stateKey struct{}
+
+// Transport is an http.RoundTripper comparing the trace context of the
+// requests it sends with the one of the inbound request they are made for.
+// It must see the final headers, so it goes below any RoundTripper adding
+// them, such as otelhttp's.
+type Transport struct {
+	// Base sends the requests (http.DefaultTransport when nil).
+	Base http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if st, ok := req.Context().Value(stateKey{}).(*state); ok && st.traceID.IsValid() {
+		if _, traceID := inbound(req.Header); traceID != st.traceID {
+			st.mu.Lock()
+			st.broken = true
+			st.mu.Unlock()
+		}
+	}
+	return base.RoundTrip(req)
+}
+
+// Summary is the share of each class among the requests classified since a
+// Checker was created.
+type Summary struct {
+	Since    time.Time    `json:"since"`
+	Requests int64        `json:"requests"`
+	Classes  []ClassCount `json:"classes"`
+}
+
+type ClassCount struct {
+	Class    Class   `json:"class"`
+	Requests int64   `json:"requests"`
+	Percent  float64 `json:"percent"`
+}
+
+// Summary returns the current counts.
+func (c *Checker) Summary() Summary {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := Summary{Since: c.since, Classes: make([]ClassCount, 0, len(Classes))}
+	for _, class := range Classes {
+		s.Requests += c.counts[class]
+	}
+	for _, class := range Classes {
+		cc := ClassCount{Class: class, Requests: c.counts[class]}
+		if s.Requests > 0 {
+			cc.Percent = math.Round(float64(cc.Requests)*1000/float64(s.Requests)) / 10
+		}
+		s.Classes = append(s.Classes, cc)
+	}
+	return s
+}
+
+// ServeHTTP serves the Summary as JSON, for /debug/propagation.
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(c.Summary())
+}
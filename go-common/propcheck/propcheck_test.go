@@ -0,0 +1,236 @@
+package propcheck
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+const (
+	traceID      = "4bf92f3577b34da6a3ce929d0e0e4736"
+	otherTraceID = "80f198ee56343ba864fe8b2a57d3eff7"
+	spanID       = "00f067aa0ba902b7"
+)
+
+var (
+	traceparent = "00-" + traceID + "-" + spanID + "-01"
+	// downstream continues traceID from a child span.
+	downstream = "00-" + traceID + "-b7ad6b7169203331-01"
+)
+
+// header returns the header with the given name and value pairs.
+func header(kv ...string) http.Header {
+	h := http.Header{}
+	for i := 0; i < len(kv); i += 2 {
+		h.Set(kv[i], kv[i+1])
+	}
+	return h
+}
+
+// roundTripper answers every request without sending it.
+type roundTripper struct {
+	reqs []*http.Request
+}
+
+func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.reqs = append(rt.reqs, req)
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+func newChecker(t *testing.T, exclude ...string) *Checker {
+	t.Helper()
+	c, err := New(Config{Exclude: exclude, MeterProvider: noop.NewMeterProvider()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// serve sends c's handler a request for path with the inbound headers; the
+// handler makes one outgoing request through Transport per outbound header.
+func serve(t *testing.T, c *Checker, method, path string, inbound http.Header, outbound ...http.Header) {
+	t.Helper()
+	transport := &Transport{Base: &roundTripper{}}
+	h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, o := range outbound {
+			req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, "http://java-service:8080/notifications/send", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header = o
+			if _, err := transport.RoundTrip(req); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}))
+	req := httptest.NewRequest(method, path, nil)
+	req.Header = inbound
+	h.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+// counts returns the requests counted by class, leaving out empty classes.
+func counts(c *Checker) map[Class]int64 {
+	got := map[Class]int64{}
+	for _, cc := range c.Summary().Classes {
+		if cc.Requests > 0 {
+			got[cc.Class] = cc.Requests
+		}
+	}
+	return got
+}
+
+func TestClassify(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		inbound  http.Header
+		outbound []http.Header
+		want     Class
+	}{
+		{
+			name:    "traceparent without outgoing requests",
+			inbound: header("traceparent", traceparent),
+			want:    ClassValidParent,
+		},
+		{
+			name:     "traceparent continued",
+			inbound:  header("traceparent", traceparent, "X-B3-TraceId", traceID, "X-B3-SpanId", spanID),
+			outbound: []http.Header{header("traceparent", downstream)},
+			want:     ClassValidParent,
+		},
+		{
+			name:     "B3 multi continued",
+			inbound:  header("X-B3-TraceId", traceID, "X-B3-SpanId", spanID, "X-B3-Sampled", "1"),
+			outbound: []http.Header{header("X-B3-TraceId", traceID, "X-B3-SpanId", "b7ad6b7169203331")},
+			want:     ClassB3Only,
+		},
+		{
+			name:    "B3 single header",
+			inbound: header("b3", traceID+"-"+spanID+"-1"),
+			want:    ClassB3Only,
+		},
+		{
+			name:     "B3 continued as traceparent",
+			inbound:  header("b3", traceID+"-"+spanID+"-1"),
+			outbound: []http.Header{header("traceparent", downstream)},
+			want:     ClassB3Only,
+		},
+		{
+			name:    "invalid traceparent",
+			inbound: header("traceparent", "00-"+traceID+"-0000000000000000-01"),
+			want:    ClassNoContext,
+		},
+		{
+			name:     "no context with a new trace downstream",
+			inbound:  header(),
+			outbound: []http.Header{header("traceparent", "00-"+otherTraceID+"-b7ad6b7169203331-01")},
+			want:     ClassNoContext,
+		},
+		{
+			name:     "other trace downstream",
+			inbound:  header("traceparent", traceparent),
+			outbound: []http.Header{header("traceparent", "00-"+otherTraceID+"-b7ad6b7169203331-01")},
+			want:     ClassMismatch,
+		},
+		{
+			name:     "no context downstream",
+			inbound:  header("X-B3-TraceId", traceID, "X-B3-SpanId", spanID),
+			outbound: []http.Header{header("Content-Type", "application/json")},
+			want:     ClassMismatch,
+		},
+		{
+			name:     "second outgoing request loses the trace",
+			inbound:  header("traceparent", traceparent),
+			outbound: []http.Header{header("traceparent", downstream), header()},
+			want:     ClassMismatch,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newChecker(t)
+			serve(t, c, http.MethodPost, "/pricing/calculate", tt.inbound, tt.outbound...)
+			if got, want := counts(c), map[Class]int64{tt.want: 1}; !reflect.DeepEqual(got, want) {
+				t.Errorf("counts = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestExclude(t *testing.T) {
+	c := newChecker(t, "/health", "/debug/")
+	for _, r := range []struct{ method, path string }{
+		{http.MethodGet, "/health"},
+		{http.MethodGet, "/debug/propagation"},
+		{http.MethodGet, "/debug/tracez"},
+		{http.MethodOptions, "/pricing/calculate"},
+	} {
+		serve(t, c, r.method, r.path, header())
+	}
+	if got := counts(c); len(got) != 0 {
+		t.Errorf("excluded requests counted: %v", got)
+	}
+
+	serve(t, c, http.MethodGet, "/healthz", header())
+	serve(t, c, http.MethodGet, "/debug", header())
+	if got, want := counts(c), map[Class]int64{ClassNoContext: 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("counts = %v, want %v", got, want)
+	}
+}
+
+// TestTransportWithoutHandler checks that requests made outside a Checker's
+// Handler are sent unchanged.
+func TestTransportWithoutHandler(t *testing.T) {
+	base := &roundTripper{}
+	req := httptest.NewRequest(http.MethodPost, "http://java-service:8080/notifications/send", nil)
+	req.Header = header("traceparent", downstream)
+	resp, err := (&Transport{Base: base}).RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || len(base.reqs) != 1 || base.reqs[0] != req {
+		t.Errorf("status %d, base got %d requests; want the request sent once", resp.StatusCode, len(base.reqs))
+	}
+}
+
+func TestSummary(t *testing.T) {
+	c := newChecker(t)
+	want := []ClassCount{
+		{Class: ClassValidParent},
+		{Class: ClassB3Only},
+		{Class: ClassNoContext},
+		{Class: ClassMismatch},
+	}
+	if got := c.Summary(); got.Requests != 0 || !reflect.DeepEqual(got.Classes, want) {
+		t.Errorf("empty Summary = %+v, want every class at 0", got)
+	}
+
+	for range 4 {
+		serve(t, c, http.MethodPost, "/pricing/calculate", header("traceparent", traceparent))
+	}
+	serve(t, c, http.MethodPost, "/pricing/calculate", header())
+	serve(t, c, http.MethodPost, "/pricing/calculate", header("traceparent", traceparent), header())
+
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/propagation", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var got Summary
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	want = []ClassCount{
+		{Class: ClassValidParent, Requests: 4, Percent: 66.7},
+		{Class: ClassB3Only},
+		{Class: ClassNoContext, Requests: 1, Percent: 16.7},
+		{Class: ClassMismatch, Requests: 1, Percent: 16.7},
+	}
+	if got.Requests != 6 || !reflect.DeepEqual(got.Classes, want) {
+		t.Errorf("summary = %+v, want 6 requests in %+v", got, want)
+	}
+	if !got.Since.Equal(c.since) {
+		t.Errorf("since = %v, want %v", got.Since, c.since)
+	}
+}
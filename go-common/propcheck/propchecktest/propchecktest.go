@@ -0,0 +1,124 @@
+// Package propchecktest runs the services' propagation conformance tests:
+// the service's handler runs in-process between a fake upstream sending the
+// headers Envoy's ingress would and a stand-in for the Java notification
+// service recording the headers that reach it. Only the expected headers
+// differ from one service to the next.
+package propchecktest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	UpstreamTraceID   = "4bf92f3577b34da6a3ce929d0e0e4736"
+	UpstreamSpanID    = "00f067aa0ba902b7"
+	UpstreamRequestID = "5f1f7a3c-9e1b-4a7e-8c41-3d2b6f0e9a10"
+)
+
+// UpstreamHeaders are the W3C and B3 headers of the caller's span and the
+// request ID, as Envoy sends them.
+var UpstreamHeaders = map[string]string{
+	"traceparent":  "00-" + UpstreamTraceID + "-" + UpstreamSpanID + "-01",
+	"x-b3-traceid": UpstreamTraceID,
+	"x-b3-spanid":  UpstreamSpanID,
+	"x-b3-sampled": "1",
+	"x-request-id": UpstreamRequestID,
+}
+
+// plainHeaders are set on every notification by the handlers and net/http.
+var plainHeaders = map[string]bool{
+	"Accept-Encoding": true,
+	"Content-Length":  true,
+	"Content-Type":    true,
+	"User-Agent":      true,
+}
+
+// Case is a request to one of the service's routes.
+type Case struct {
+	Path string
+	// Status is the status the service answers with.
+	Status int
+}
+
+// Run points JAVA_SERVICE_URL at a stand-in for the Java service, builds
+// the service's handler with newHandler and sends it a pricing request with
+// UpstreamHeaders for every case. Each request must send exactly one
+// notification; check gets the headers it carried other than the ones every
+// notification has, by lower-case name.
+func Run(t *testing.T, newHandler func(*testing.T) http.Handler, cases []Case, check func(t *testing.T, got map[string]string)) {
+	t.Helper()
+	java := newJavaStub(t)
+	h := newHandler(t)
+
+	for _, tt := range cases {
+		t.Run(tt.Path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.Path, strings.NewReader(`{"product_name": "Laptop", "quantity": 2}`))
+			req.Header.Set("Content-Type", "application/json")
+			for name, v := range UpstreamHeaders {
+				req.Header.Set(name, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != tt.Status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.Status, w.Body)
+			}
+
+			received := java.take()
+			if len(received) != 1 {
+				t.Fatalf("Java service received %d notifications, want 1", len(received))
+			}
+			check(t, propagated(received[0]))
+		})
+	}
+}
+
+// javaStub stands in for the Java service's /notifications/send.
+type javaStub struct {
+	mu       sync.Mutex
+	received []http.Header
+}
+
+// newJavaStub starts a javaStub and points JAVA_SERVICE_URL at it.
+func newJavaStub(t *testing.T) *javaStub {
+	t.Helper()
+	s := &javaStub{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/notifications/send" {
+			http.NotFound(w, r)
+			return
+		}
+		s.mu.Lock()
+		s.received = append(s.received, r.Header.Clone())
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"SENT"}`))
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("JAVA_SERVICE_URL", srv.URL)
+	return s
+}
+
+// take returns the headers received since the last call.
+func (s *javaStub) take() []http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := s.received
+	s.received = nil
+	return h
+}
+
+// propagated returns the headers of h other than plainHeaders, by
+// lower-case name.
+func propagated(h http.Header) map[string]string {
+	out := make(map[string]string)
+	for name, values := range h {
+		if !plainHeaders[name] {
+			out[strings.ToLower(name)] = strings.Join(values, ",")
+		}
+	}
+	return out
+}
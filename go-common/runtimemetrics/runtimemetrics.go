@@ -0,0 +1,55 @@
+// Package runtimemetrics records the Go runtime metrics of a service:
+// memory, goroutines, GOMAXPROCS and GOGC from the contrib runtime
+// instrumentation, plus GC cycle and pause counters, which it only offers
+// among its deprecated metrics. go.schedule.duration is a histogram computed
+// by the runtime; it comes from runtime.NewProducer, attached to the
+// MeterProvider's readers by the caller.
+package runtimemetrics
+
+import (
+	"context"
+	goruntime "runtime"
+
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "github.com/nutslove/otel-instrumentation-demo/go-common/runtimemetrics"
+
+// Start registers the runtime instruments on mp (the global MeterProvider
+// when nil).
+func Start(mp metric.MeterProvider) error {
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	if err := runtime.Start(runtime.WithMeterProvider(mp)); err != nil {
+		return err
+	}
+
+	meter := mp.Meter(instrumentationName)
+	gcCount, err := meter.Int64ObservableCounter("go.gc.count",
+		metric.WithDescription("Number of completed garbage collection cycles."),
+		metric.WithUnit("{gc_cycle}"),
+	)
+	if err != nil {
+		return err
+	}
+	gcPause, err := meter.Float64ObservableCounter("go.gc.pause.time",
+		metric.WithDescription("Cumulative time spent in garbage collection stop-the-world pauses."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		// ReadMemStats stops the world briefly; once per collection is cheap.
+		var m goruntime.MemStats
+		goruntime.ReadMemStats(&m)
+		o.ObserveInt64(gcCount, int64(m.NumGC))
+		o.ObserveFloat64(gcPause, float64(m.PauseTotalNs)/1e9)
+		return nil
+	}, gcCount, gcPause)
+	return err
+}
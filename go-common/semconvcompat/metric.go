@@ -0,0 +1,29 @@
+package semconvcompat
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// Views drops the current HTTP attribute names from the http.server.* and
+// http.client.* metrics when HTTP() is "old". otelgin and otelhttp always
+// record them; their old names come in through the libraries' metric
+// attribute hooks (see Mode.Legacy). Metrics the services record themselves
+// use Mode.Attributes instead and need no view.
+func Views() []sdkmetric.View {
+	if HTTP().EmitNew() {
+		return nil
+	}
+	return []sdkmetric.View{
+		sdkmetric.NewView(sdkmetric.Instrument{Name: "http.server.*"}, sdkmetric.Stream{AttributeFilter: without(HTTPServerKeys)}),
+		sdkmetric.NewView(sdkmetric.Instrument{Name: "http.client.*"}, sdkmetric.Stream{AttributeFilter: without(HTTPClientKeys)}),
+	}
+}
+
+// without keeps every attribute that keys does not rename.
+func without(keys Keys) attribute.Filter {
+	return func(kv attribute.KeyValue) bool {
+		_, renamed := keys[kv.Key]
+		return !renamed
+	}
+}
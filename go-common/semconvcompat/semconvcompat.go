@@ -0,0 +1,194 @@
+// Package semconvcompat implements the OTEL_SEMCONV_STABILITY_OPT_IN switch
+// for the Go services. Instrumentation writes the current (v1.37) HTTP and
+// database attribute names; depending on the switch they are exported as
+// they are, replaced by the names used before the conventions were
+// stabilised, or with both, so dashboards and collector rules can move over
+// without a gap in the data.
+//
+// The values follow the specification, plus an "/old" form that the
+// upstream instrumentation libraries no longer offer:
+//
+//	http, database          current names only (the default)
+//	http/dup, database/dup  current and old names
+//	http/old, database/old  old names only
+package semconvcompat
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	oldhttp "go.opentelemetry.io/otel/semconv/v1.20.0"
+	olddb "go.opentelemetry.io/otel/semconv/v1.24.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// EnvOptIn is the environment variable holding the comma-separated
+// opt-in list.
+const EnvOptIn = "OTEL_SEMCONV_STABILITY_OPT_IN"
+
+// Mode selects which attribute names of a domain are emitted.
+type Mode uint8
+
+const (
+	// New emits the current names.
+	New Mode = 1 << iota
+	// Old emits the names from before the migration: semconv v1.20 for
+	// HTTP and v1.24 for databases.
+	Old
+	// Dup emits both.
+	Dup = New | Old
+)
+
+func (m Mode) EmitNew() bool { return m&New != 0 }
+func (m Mode) EmitOld() bool { return m&Old != 0 }
+
+func (m Mode) String() string {
+	switch m {
+	case Dup:
+		return "dup"
+	case Old:
+		return "old"
+	default:
+		return "new"
+	}
+}
+
+var modes = sync.OnceValues(func() (Mode, Mode) {
+	return ParseOptIn(os.Getenv(EnvOptIn))
+})
+
+// HTTP returns the mode for HTTP attributes set in OTEL_SEMCONV_STABILITY_OPT_IN.
+func HTTP() Mode {
+	h, _ := modes()
+	return h
+}
+
+// Database returns the mode for database attributes set in
+// OTEL_SEMCONV_STABILITY_OPT_IN.
+func Database() Mode {
+	_, db := modes()
+	return db
+}
+
+// ParseOptIn parses an OTEL_SEMCONV_STABILITY_OPT_IN value. Unknown entries
+// are ignored and, as in the specification, "/dup" wins when a domain is
+// listed more than once.
+func ParseOptIn(v string) (http, database Mode) {
+	http, database = New, New
+	var seen [2]Mode
+	for _, entry := range strings.Split(v, ",") {
+		domain, variant, _ := strings.Cut(strings.ToLower(strings.TrimSpace(entry)), "/")
+		var m Mode
+		switch variant {
+		case "":
+			m = New
+		case "dup":
+			m = Dup
+		case "old":
+			m = Old
+		default:
+			continue
+		}
+		switch domain {
+		case "http":
+			seen[0] |= m
+		case "database":
+			seen[1] |= m
+		}
+	}
+	if seen[0] != 0 {
+		http = seen[0]
+	}
+	if seen[1] != 0 {
+		database = seen[1]
+	}
+	return http, database
+}
+
+// Keys maps the current attribute names of a domain to the old ones.
+// Attributes without an entry, such as http.route, kept their name.
+type Keys map[attribute.Key]attribute.Key
+
+var (
+	// HTTPServerKeys covers server spans and http.server.* metrics.
+	HTTPServerKeys = Keys{
+		semconv.HTTPRequestMethodKey:      oldhttp.HTTPMethodKey,
+		semconv.HTTPResponseStatusCodeKey: oldhttp.HTTPStatusCodeKey,
+		semconv.URLSchemeKey:              oldhttp.HTTPSchemeKey,
+		semconv.URLPathKey:                oldhttp.HTTPTargetKey,
+		semconv.ServerAddressKey:          oldhttp.NetHostNameKey,
+		semconv.ServerPortKey:             oldhttp.NetHostPortKey,
+		semconv.ClientAddressKey:          oldhttp.HTTPClientIPKey,
+		semconv.NetworkProtocolVersionKey: oldhttp.NetProtocolVersionKey,
+		semconv.NetworkPeerAddressKey:     oldhttp.NetSockPeerAddrKey,
+		semconv.NetworkPeerPortKey:        oldhttp.NetSockPeerPortKey,
+		semconv.HTTPRequestBodySizeKey:    oldhttp.HTTPRequestContentLengthKey,
+		semconv.HTTPResponseBodySizeKey:   oldhttp.HTTPResponseContentLengthKey,
+	}
+
+	// HTTPClientKeys covers client spans and http.client.* metrics.
+	HTTPClientKeys = Keys{
+		semconv.HTTPRequestMethodKey:      oldhttp.HTTPMethodKey,
+		semconv.HTTPResponseStatusCodeKey: oldhttp.HTTPStatusCodeKey,
+		semconv.URLFullKey:                oldhttp.HTTPURLKey,
+		semconv.ServerAddressKey:          oldhttp.NetPeerNameKey,
+		semconv.ServerPortKey:             oldhttp.NetPeerPortKey,
+		semconv.NetworkProtocolVersionKey: oldhttp.NetProtocolVersionKey,
+		semconv.NetworkPeerAddressKey:     oldhttp.NetSockPeerAddrKey,
+		semconv.NetworkPeerPortKey:        oldhttp.NetSockPeerPortKey,
+		semconv.HTTPRequestBodySizeKey:    oldhttp.HTTPRequestContentLengthKey,
+		semconv.HTTPResponseBodySizeKey:   oldhttp.HTTPResponseContentLengthKey,
+	}
+
+	// DatabaseKeys covers database client spans and db.client.* metrics.
+	DatabaseKeys = Keys{
+		semconv.DBSystemNameKey:               olddb.DBSystemKey,
+		semconv.DBNamespaceKey:                olddb.DBNameKey,
+		semconv.DBOperationNameKey:            olddb.DBOperationKey,
+		semconv.DBCollectionNameKey:           olddb.DBSQLTableKey,
+		semconv.DBQueryTextKey:                olddb.DBStatementKey,
+		semconv.DBClientConnectionPoolNameKey: olddb.PoolNameKey,
+		semconv.DBClientConnectionStateKey:    olddb.StateKey,
+	}
+)
+
+// Attributes returns kvs, written with the current names, as m emits them.
+func (m Mode) Attributes(keys Keys, kvs ...attribute.KeyValue) []attribute.KeyValue {
+	if m == New {
+		return kvs
+	}
+	out := make([]attribute.KeyValue, 0, 2*len(kvs))
+	for _, kv := range kvs {
+		if _, renamed := keys[kv.Key]; !renamed || m.EmitNew() {
+			out = append(out, kv)
+		}
+	}
+	return append(out, m.Legacy(keys, kvs...)...)
+}
+
+// Legacy returns the old-name copies of kvs when m emits the old names, and
+// nil otherwise. It is meant for the attribute hooks of instrumentation
+// that only writes the current names itself.
+func (m Mode) Legacy(keys Keys, kvs ...attribute.KeyValue) []attribute.KeyValue {
+	if !m.EmitOld() {
+		return nil
+	}
+	var out []attribute.KeyValue
+	for _, kv := range kvs {
+		if old, ok := keys[kv.Key]; ok && !has(kvs, old) {
+			out = append(out, attribute.KeyValue{Key: old, Value: kv.Value})
+		}
+	}
+	return out
+}
+
+func has(kvs []attribute.KeyValue, key attribute.Key) bool {
+	for _, kv := range kvs {
+		if kv.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,140 @@
+package semconvcompat
+
+import (
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+func TestParseOptIn(t *testing.T) {
+	for _, tt := range []struct {
+		in           string
+		http, dbMode Mode
+	}{
+		{in: "", http: New, dbMode: New},
+		{in: "http", http: New, dbMode: New},
+		{in: "http/dup", http: Dup, dbMode: New},
+		{in: "http/old", http: Old, dbMode: New},
+		{in: "database/dup", http: New, dbMode: Dup},
+		{in: "database/old", http: New, dbMode: Old},
+		{in: "http/dup,database/dup", http: Dup, dbMode: Dup},
+		{in: "http,database/dup", http: New, dbMode: Dup},
+		{in: " HTTP/Dup , Database ", http: Dup, dbMode: New},
+		// /dup wins when a domain is listed more than once
+		{in: "http,http/dup", http: Dup, dbMode: New},
+		{in: "http/old,http/dup", http: Dup, dbMode: New},
+		{in: "http/old,http", http: Dup, dbMode: New},
+		// Unknown domains and variants are ignored
+		{in: "messaging/dup,http/v2,database/latest", http: New, dbMode: New},
+	} {
+		http, db := ParseOptIn(tt.in)
+		if http != tt.http || db != tt.dbMode {
+			t.Errorf("ParseOptIn(%q) = %v, %v; want %v, %v", tt.in, http, db, tt.http, tt.dbMode)
+		}
+	}
+}
+
+func TestMode(t *testing.T) {
+	for _, tt := range []struct {
+		mode             Mode
+		emitNew, emitOld bool
+		name             string
+	}{
+		{New, true, false, "new"},
+		{Old, false, true, "old"},
+		{Dup, true, true, "dup"},
+	} {
+		if tt.mode.EmitNew() != tt.emitNew || tt.mode.EmitOld() != tt.emitOld || tt.mode.String() != tt.name {
+			t.Errorf("%v: EmitNew %v, EmitOld %v; want %s with %v, %v",
+				tt.mode, tt.mode.EmitNew(), tt.mode.EmitOld(), tt.name, tt.emitNew, tt.emitOld)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		keys     Keys
+		current  attribute.Key
+		old      attribute.Key
+		notFound attribute.Key
+	}{
+		{"server method", HTTPServerKeys, semconv.HTTPRequestMethodKey, "http.method", semconv.HTTPRouteKey},
+		{"server path", HTTPServerKeys, semconv.URLPathKey, "http.target", semconv.URLFullKey},
+		{"server address", HTTPServerKeys, semconv.ServerAddressKey, "net.host.name", semconv.HTTPRouteKey},
+		{"server client address", HTTPServerKeys, semconv.ClientAddressKey, "http.client_ip", semconv.URLFullKey},
+		{"client URL", HTTPClientKeys, semconv.URLFullKey, "http.url", semconv.URLPathKey},
+		{"client address", HTTPClientKeys, semconv.ServerAddressKey, "net.peer.name", semconv.ClientAddressKey},
+		{"client status", HTTPClientKeys, semconv.HTTPResponseStatusCodeKey, "http.status_code", semconv.HTTPRouteKey},
+		{"db system", DatabaseKeys, semconv.DBSystemNameKey, "db.system", semconv.ServerAddressKey},
+		{"db query", DatabaseKeys, semconv.DBQueryTextKey, "db.statement", semconv.ServerAddressKey},
+		{"db table", DatabaseKeys, semconv.DBCollectionNameKey, "db.sql.table", semconv.ServerAddressKey},
+		{"db operation", DatabaseKeys, semconv.DBOperationNameKey, "db.operation", semconv.ServerAddressKey},
+	} {
+		if got := tt.keys[tt.current]; got != tt.old {
+			t.Errorf("%s: %s maps to %q, want %q", tt.name, tt.current, got, tt.old)
+		}
+		if got, ok := tt.keys[tt.notFound]; ok {
+			t.Errorf("%s: %s maps to %q, want no rename", tt.name, tt.notFound, got)
+		}
+	}
+
+	for name, keys := range map[string]Keys{"HTTPServerKeys": HTTPServerKeys, "HTTPClientKeys": HTTPClientKeys, "DatabaseKeys": DatabaseKeys} {
+		olds := map[attribute.Key]attribute.Key{}
+		for current, old := range keys {
+			if current == old {
+				t.Errorf("%s: %s maps to itself", name, current)
+			}
+			if other, dup := olds[old]; dup {
+				t.Errorf("%s: %s and %s both map to %s", name, current, other, old)
+			}
+			olds[old] = current
+		}
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	kvs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodGet,
+		semconv.HTTPResponseStatusCode(200),
+		semconv.HTTPRoute("/pricing"),
+	}
+	oldMethod := attribute.String("http.method", "GET")
+	oldStatus := attribute.Int("http.status_code", 200)
+
+	for _, tt := range []struct {
+		mode       Mode
+		attributes []attribute.KeyValue
+		legacy     []attribute.KeyValue
+	}{
+		{
+			mode:       New,
+			attributes: kvs,
+		},
+		{
+			mode:       Dup,
+			attributes: append(append([]attribute.KeyValue{}, kvs...), oldMethod, oldStatus),
+			legacy:     []attribute.KeyValue{oldMethod, oldStatus},
+		},
+		{
+			mode:       Old,
+			attributes: []attribute.KeyValue{semconv.HTTPRoute("/pricing"), oldMethod, oldStatus},
+			legacy:     []attribute.KeyValue{oldMethod, oldStatus},
+		},
+	} {
+		if got := tt.mode.Attributes(HTTPServerKeys, kvs...); !reflect.DeepEqual(got, tt.attributes) {
+			t.Errorf("%v.Attributes = %v, want %v", tt.mode, got, tt.attributes)
+		}
+		if got := tt.mode.Legacy(HTTPServerKeys, kvs...); !reflect.DeepEqual(got, tt.legacy) {
+			t.Errorf("%v.Legacy = %v, want %v", tt.mode, got, tt.legacy)
+		}
+	}
+
+	// An old name the instrumentation already set is not added twice
+	withOld := append([]attribute.KeyValue{attribute.String("http.method", "POST")}, kvs...)
+	if got, want := Dup.Legacy(HTTPServerKeys, withOld...), []attribute.KeyValue{oldStatus}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Legacy with http.method set = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,66 @@
+package semconvcompat
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SpanExporter renames the HTTP and database attributes of the spans it
+// exports according to HTTP() and Database(). Doing it at export covers
+// every instrumentation library (otelgin, otelhttp, otelsql) in one place.
+// exp is returned as is when both domains keep the current names.
+func SpanExporter(exp sdktrace.SpanExporter) sdktrace.SpanExporter {
+	http, db := HTTP(), Database()
+	if http == New && db == New {
+		return exp
+	}
+	return &spanExporter{SpanExporter: exp, http: http, db: db}
+}
+
+type spanExporter struct {
+	sdktrace.SpanExporter
+	http, db Mode
+}
+
+func (e *spanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	out := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, s := range spans {
+		out[i] = e.convert(s)
+	}
+	return e.SpanExporter.ExportSpans(ctx, out)
+}
+
+// convert picks the domain from the attributes that identify it.
+func (e *spanExporter) convert(s sdktrace.ReadOnlySpan) sdktrace.ReadOnlySpan {
+	attrs := s.Attributes()
+	var (
+		mode Mode
+		keys Keys
+	)
+	switch {
+	case has(attrs, semconv.DBSystemNameKey):
+		mode, keys = e.db, DatabaseKeys
+	case has(attrs, semconv.HTTPRequestMethodKey) && s.SpanKind() == trace.SpanKindServer:
+		mode, keys = e.http, HTTPServerKeys
+	case has(attrs, semconv.HTTPRequestMethodKey) && s.SpanKind() == trace.SpanKindClient:
+		mode, keys = e.http, HTTPClientKeys
+	default:
+		return s
+	}
+	if mode == New {
+		return s
+	}
+	return convertedSpan{ReadOnlySpan: s, attrs: mode.Attributes(keys, attrs...)}
+}
+
+// convertedSpan is a span with its attributes replaced.
+type convertedSpan struct {
+	sdktrace.ReadOnlySpan
+	attrs []attribute.KeyValue
+}
+
+func (s convertedSpan) Attributes() []attribute.KeyValue { return s.attrs }
@@ -0,0 +1,140 @@
+package semconvcompat
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// exportSpans records one span per kind and attribute set through an
+// exporter for the given modes and returns the attributes exported, by span
+// name.
+func exportSpans(t *testing.T, http, db Mode) map[string]map[attribute.Key]attribute.Value {
+	t.Helper()
+	recorder := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(&spanExporter{SpanExporter: recorder, http: http, db: db}))
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	tracer := tp.Tracer("semconvcompat_test")
+
+	for _, s := range []struct {
+		name  string
+		kind  trace.SpanKind
+		attrs []attribute.KeyValue
+	}{
+		{"server", trace.SpanKindServer, []attribute.KeyValue{
+			semconv.HTTPRequestMethodPost, semconv.URLPath("/pricing/calculate"), semconv.HTTPRoute("/pricing/calculate"),
+		}},
+		{"client", trace.SpanKindClient, []attribute.KeyValue{
+			semconv.HTTPRequestMethodPost, semconv.URLFull("http://java-service:8080/notify"), semconv.ServerAddress("java-service"),
+		}},
+		{"db", trace.SpanKindClient, []attribute.KeyValue{
+			semconv.DBSystemNameSQLite, semconv.DBQueryText("SELECT unit_price FROM pricing"),
+		}},
+		{"internal", trace.SpanKindInternal, []attribute.KeyValue{
+			semconv.HTTPRequestMethodGet,
+		}},
+		{"plain", trace.SpanKindServer, []attribute.KeyValue{
+			attribute.String("product.name", "Laptop"),
+		}},
+	} {
+		_, span := tracer.Start(context.Background(), s.name, trace.WithSpanKind(s.kind), trace.WithAttributes(s.attrs...))
+		span.End()
+	}
+
+	got := map[string]map[attribute.Key]attribute.Value{}
+	for _, s := range recorder.GetSpans() {
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, kv := range s.Attributes {
+			attrs[kv.Key] = kv.Value
+		}
+		got[s.Name] = attrs
+	}
+	return got
+}
+
+func TestSpanExporter(t *testing.T) {
+	var (
+		post     = attribute.StringValue("POST")
+		get      = attribute.StringValue("GET")
+		path     = attribute.StringValue("/pricing/calculate")
+		url      = attribute.StringValue("http://java-service:8080/notify")
+		peer     = attribute.StringValue("java-service")
+		sqlite   = semconv.DBSystemNameSQLite.Value
+		query    = attribute.StringValue("SELECT unit_price FROM pricing")
+		laptop   = attribute.StringValue("Laptop")
+		internal = map[attribute.Key]attribute.Value{"http.request.method": get}
+		plain    = map[attribute.Key]attribute.Value{"product.name": laptop}
+	)
+
+	for _, tt := range []struct {
+		name     string
+		http, db Mode
+		want     map[string]map[attribute.Key]attribute.Value
+	}{
+		{
+			name: "new",
+			http: New, db: New,
+			want: map[string]map[attribute.Key]attribute.Value{
+				"server":   {"http.request.method": post, "url.path": path, "http.route": path},
+				"client":   {"http.request.method": post, "url.full": url, "server.address": peer},
+				"db":       {"db.system.name": sqlite, "db.query.text": query},
+				"internal": internal,
+				"plain":    plain,
+			},
+		},
+		{
+			name: "http/dup",
+			http: Dup, db: New,
+			want: map[string]map[attribute.Key]attribute.Value{
+				"server": {
+					"http.request.method": post, "url.path": path, "http.route": path,
+					"http.method": post, "http.target": path,
+				},
+				"client": {
+					"http.request.method": post, "url.full": url, "server.address": peer,
+					"http.method": post, "http.url": url, "net.peer.name": peer,
+				},
+				"db":       {"db.system.name": sqlite, "db.query.text": query},
+				"internal": internal,
+				"plain":    plain,
+			},
+		},
+		{
+			name: "http/old,database/dup",
+			http: Old, db: Dup,
+			want: map[string]map[attribute.Key]attribute.Value{
+				"server": {"http.method": post, "http.target": path, "http.route": path},
+				"client": {"http.method": post, "http.url": url, "net.peer.name": peer},
+				"db": {
+					"db.system.name": sqlite, "db.query.text": query,
+					"db.system": sqlite, "db.statement": query,
+				},
+				"internal": internal,
+				"plain":    plain,
+			},
+		},
+		{
+			name: "database/old",
+			http: New, db: Old,
+			want: map[string]map[attribute.Key]attribute.Value{
+				"server":   {"http.request.method": post, "url.path": path, "http.route": path},
+				"client":   {"http.request.method": post, "url.full": url, "server.address": peer},
+				"db":       {"db.system": sqlite, "db.statement": query},
+				"internal": internal,
+				"plain":    plain,
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exportSpans(t, tt.http, tt.db); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("exported attributes =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+// Package sqlcomment adds sqlcommenter comments
+// (https://google.github.io/sqlcommenter/spec/) to SQL statements, with the
+// trace context and HTTP route of the request running them, so that a query
+// seen on the database side, e.g. in the query log, leads back to its trace:
+//
+//	SELECT unit_price FROM pricing WHERE product_name = ? /*traceparent='00-...-01',route='%2Fpricing%2Fcalculate'*/
+//
+// NewConnector wraps a driver that comments and logs the statements. Under
+// github.com/XSAM/otelsql the traceparent is the one of the DB span
+// otelsql creates for the statement. For services whose spans are recorded
+// outside the process, Open uses it directly; the traceparent is then the
+// one of the incoming request (see tracelog), whose span ID is the caller's
+// span.
+package sqlcomment
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type routeKey struct{}
+
+// ContextWithRoute returns ctx with the HTTP route to put in the comments of
+// the statements run with it.
+func ContextWithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+// Comment appends the comment for ctx to query: the traceparent of the span
+// context in ctx and the route from ContextWithRoute. Statements that
+// already contain a comment are left alone, as the spec requires.
+func Comment(ctx context.Context, query string) string {
+	var kvs []string
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		traceparent := fmt.Sprintf("00-%s-%s-%s", sc.TraceID(), sc.SpanID(), sc.TraceFlags())
+		kvs = append(kvs, pair("traceparent", traceparent))
+	}
+	if route, _ := ctx.Value(routeKey{}).(string); route != "" {
+		kvs = append(kvs, pair("route", route))
+	}
+	if len(kvs) == 0 || strings.Contains(query, "/*") {
+		return query
+	}
+
+	// The comment goes before a trailing semicolon.
+	stmt := strings.TrimRight(query, " \t\r\n")
+	semicolon := strings.HasSuffix(stmt, ";")
+	stmt = strings.TrimSuffix(stmt, ";")
+	out := stmt + " /*" + strings.Join(kvs, ",") + "*/"
+	if semicolon {
+		out += ";"
+	}
+	return out
+}
+
+// pair URL-encodes the value and quotes it.
+func pair(key, value string) string {
+	return key + "='" + strings.ReplaceAll(url.QueryEscape(value), "+", "%20") + "'"
+}
+
+// QueryLog writes one line per statement: start time, duration, outcome and
+// the statement as sent. It is safe for concurrent use.
+type QueryLog struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewQueryLog returns a QueryLog writing to w.
+func NewQueryLog(w io.Writer) *QueryLog {
+	return &QueryLog{w: w}
+}
+
+// Record logs query, started at start, with its outcome err.
+func (l *QueryLog) Record(start time.Time, query string, err error) {
+	status := "ok"
+	if err != nil {
+		status = "error: " + strings.ReplaceAll(err.Error(), "\n", " ")
+	}
+	line := fmt.Sprintf("%s duration=%s status=%q %s\n",
+		start.UTC().Format(time.RFC3339Nano), time.Since(start), status, strings.Join(strings.Fields(query), " "))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, line)
+}
+
+// Open opens a database on NewConnector(drv, dsn, log), like sql.Open.
+func Open(drv driver.Driver, dsn string, log *QueryLog) *sql.DB {
+	return sql.OpenDB(NewConnector(drv, dsn, log))
+}
+
+// NewConnector returns a connector to dsn on drv whose statements run
+// through QueryContext and ExecContext carry the comment of their context
+// and are recorded in log when it is not nil. Everything else goes to drv
+// unchanged.
+func NewConnector(drv driver.Driver, dsn string, log *QueryLog) driver.Connector {
+	return connector{dsn: dsn, driver: drv, log: log}
+}
+
+type connector struct {
+	dsn    string
+	driver driver.Driver
+	log    *QueryLog
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return commentConn{Conn: conn, log: c.log}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return c.driver
+}
+
+type commentConn struct {
+	driver.Conn
+	log *QueryLog
+}
+
+func (c commentConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	query = Comment(ctx, query)
+	start := time.Now()
+	res, err := e.ExecContext(ctx, query, args)
+	c.record(start, query, err)
+	return res, err
+}
+
+func (c commentConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	query = Comment(ctx, query)
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, query, args)
+	if err != nil {
+		c.record(start, query, err)
+		return nil, err
+	}
+	if c.log == nil {
+		return rows, nil
+	}
+	return &loggedRows{Rows: rows, log: c.log, query: query, start: start}, nil
+}
+
+func (c commentConn) record(start time.Time, query string, err error) {
+	if c.log != nil && err != driver.ErrSkip {
+		c.log.Record(start, query, err)
+	}
+}
+
+// loggedRows logs the query when database/sql closes the rows, so that the
+// duration includes stepping through them.
+type loggedRows struct {
+	driver.Rows
+	log   *QueryLog
+	query string
+	start time.Time
+	err   error
+}
+
+func (r *loggedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return err
+}
+
+func (r *loggedRows) Close() error {
+	err := r.Rows.Close()
+	if r.err == nil {
+		r.err = err
+	}
+	r.log.Record(r.start, r.query, r.err)
+	return err
+}
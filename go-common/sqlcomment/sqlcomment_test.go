@@ -0,0 +1,117 @@
+package sqlcomment
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestContext carries the trace context of traceparent
+// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01 and a route.
+func requestContext() context.Context {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	return ContextWithRoute(ctx, "/pricing/calculate")
+}
+
+const wantComment = "/*traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01',route='%2Fpricing%2Fcalculate'*/"
+
+func TestComment(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		ctx   context.Context
+		query string
+		want  string
+	}{
+		{"request", requestContext(), "SELECT 1", "SELECT 1 " + wantComment},
+		{"semicolon", requestContext(), "SELECT 1;\n", "SELECT 1 " + wantComment + ";"},
+		{"commented", requestContext(), "SELECT /* hint */ 1", "SELECT /* hint */ 1"},
+		{"route only", ContextWithRoute(context.Background(), "/pricing"), "SELECT 1", "SELECT 1 /*route='%2Fpricing'*/"},
+		{"nothing", context.Background(), "SELECT 1", "SELECT 1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Comment(tt.ctx, tt.query); got != tt.want {
+				t.Errorf("Comment(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	drv := &fakeDriver{}
+	var log bytes.Buffer
+	db := Open(drv, "test", NewQueryLog(&log))
+	defer db.Close()
+
+	ctx := requestContext()
+	if _, err := db.ExecContext(ctx, "DELETE FROM pricing"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.QueryContext(ctx, "SELECT unit_price FROM pricing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+
+	want := []string{
+		"DELETE FROM pricing " + wantComment,
+		"SELECT unit_price FROM pricing " + wantComment,
+	}
+	if strings.Join(drv.queries, "\n") != strings.Join(want, "\n") {
+		t.Errorf("statements sent = %q, want %q", drv.queries, want)
+	}
+	lines := strings.Split(strings.TrimSuffix(log.String(), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("query log = %q, want %d lines", log.String(), len(want))
+	}
+	for i, line := range lines {
+		if !strings.Contains(line, ` status="ok" `+want[i]) {
+			t.Errorf("query log line %d = %q, want status ok and %q", i, line, want[i])
+		}
+	}
+}
+
+// fakeDriver records the statements it runs; queries return no rows.
+type fakeDriver struct {
+	queries []string
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) {
+	return fakeConn{d}, nil
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func (c fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.d.queries = append(c.d.queries, query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.d.queries = append(c.d.queries, query)
+	return fakeRows{}, nil
+}
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string         { return []string{"unit_price"} }
+func (fakeRows) Close() error              { return nil }
+func (fakeRows) Next([]driver.Value) error { return io.EOF }
@@ -0,0 +1,187 @@
+package telemetry
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Environment variables from the OpenTelemetry SDK specification. The OTLP
+// exporters and the SDK already read OTEL_EXPORTER_OTLP_HEADERS, _TIMEOUT,
+// _COMPRESSION, OTEL_BSP_*, OTEL_BLRP_* and OTEL_METRIC_EXPORT_*
+// themselves; the ones below need handling here.
+const (
+	envSDKDisabled      = "OTEL_SDK_DISABLED"
+	envTracesExporter   = "OTEL_TRACES_EXPORTER"
+	envMetricsExporter  = "OTEL_METRICS_EXPORTER"
+	envLogsExporter     = "OTEL_LOGS_EXPORTER"
+	envPropagators      = "OTEL_PROPAGATORS"
+	envSampler          = "OTEL_TRACES_SAMPLER"
+	envSamplerArg       = "OTEL_TRACES_SAMPLER_ARG"
+	envEndpoint         = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	envProtocol         = "OTEL_EXPORTER_OTLP_PROTOCOL"
+	envBSPScheduleDelay = "OTEL_BSP_SCHEDULE_DELAY"
+)
+
+// Per-signal endpoint and protocol overrides.
+const (
+	envTracesEndpoint  = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	envMetricsEndpoint = "OTEL_EXPORTER_OTLP_METRICS_ENDPOINT"
+	envLogsEndpoint    = "OTEL_EXPORTER_OTLP_LOGS_ENDPOINT"
+	envTracesProtocol  = "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"
+	envMetricsProtocol = "OTEL_EXPORTER_OTLP_METRICS_PROTOCOL"
+	envLogsProtocol    = "OTEL_EXPORTER_OTLP_LOGS_PROTOCOL"
+)
+
+// applyEnv overlays the environment on top of cfg, which carries the
+// service's built-in defaults.
+func applyEnv(cfg Config) (Config, error) {
+	if disabled, _ := strconv.ParseBool(os.Getenv(envSDKDisabled)); disabled {
+		cfg.Traces, cfg.Metrics, cfg.Logs, cfg.Prometheus = false, false, false, false
+		return cfg, nil
+	}
+
+	var err error
+	if cfg.Traces, err = exporterEnabled(envTracesExporter, cfg.Traces); err != nil {
+		return cfg, err
+	}
+	if cfg.Metrics, cfg.Prometheus, err = metricsExporters(cfg.Metrics, cfg.Prometheus); err != nil {
+		return cfg, err
+	}
+	if cfg.Prometheus {
+		if cfg.PrometheusAddr, err = prometheusAddr(cfg.PrometheusAddr); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.Logs, err = exporterEnabled(envLogsExporter, cfg.Logs); err != nil {
+		return cfg, err
+	}
+
+	if cfg.Protocol == "" {
+		cfg.Protocol = ProtocolHTTPProtobuf
+	}
+	if cfg.Protocol, err = signalProtocol(envProtocol, cfg.Protocol); err != nil {
+		return cfg, err
+	}
+	if cfg.TracesProtocol, err = signalProtocol(envTracesProtocol, cfg.TracesProtocol, cfg.Protocol); err != nil {
+		return cfg, err
+	}
+	if cfg.MetricsProtocol, err = signalProtocol(envMetricsProtocol, cfg.MetricsProtocol, cfg.Protocol); err != nil {
+		return cfg, err
+	}
+	if cfg.LogsProtocol, err = signalProtocol(envLogsProtocol, cfg.LogsProtocol, cfg.Protocol); err != nil {
+		return cfg, err
+	}
+
+	// The SDK only reads these when no sampler is passed explicitly.
+	if v := os.Getenv(envSampler); v != "" {
+		cfg.Sampler = v
+		cfg.SamplerArg = os.Getenv(envSamplerArg)
+	}
+
+	if v := os.Getenv(envPropagators); v != "" {
+		cfg.Propagators = strings.Split(v, ",")
+	}
+
+	// An explicit WithBatchTimeout would shadow OTEL_BSP_SCHEDULE_DELAY.
+	if os.Getenv(envBSPScheduleDelay) != "" {
+		cfg.BatchTimeout = 0
+	}
+
+	return cfg, nil
+}
+
+// exporterEnabled interprets an OTEL_*_EXPORTER variable. Only the OTLP
+// exporter is wired in; "none" switches the signal off.
+func exporterEnabled(key string, def bool) (bool, error) {
+	switch v := strings.TrimSpace(os.Getenv(key)); v {
+	case "":
+		return def, nil
+	case "otlp":
+		return true, nil
+	case "none":
+		return false, nil
+	default:
+		return false, fmt.Errorf("unsupported %s value %q", key, v)
+	}
+}
+
+// metricsExporters interprets OTEL_METRICS_EXPORTER, which unlike the other
+// two may list several exporters: "otlp", "prometheus" or "none".
+func metricsExporters(otlp, prom bool) (bool, bool, error) {
+	v := strings.TrimSpace(os.Getenv(envMetricsExporter))
+	if v == "" {
+		return otlp, prom, nil
+	}
+
+	otlp, prom = false, false
+	for _, name := range strings.Split(v, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "otlp":
+			otlp = true
+		case "prometheus":
+			prom = true
+		case "none":
+			return false, false, nil
+		default:
+			return false, false, fmt.Errorf("unsupported %s value %q", envMetricsExporter, name)
+		}
+	}
+	return otlp, prom, nil
+}
+
+// signalProtocol returns the protocol from the environment variable key,
+// falling back to the first non-empty default.
+func signalProtocol(key string, defs ...string) (string, error) {
+	p := strings.TrimSpace(os.Getenv(key))
+	for _, def := range defs {
+		if p != "" {
+			break
+		}
+		p = def
+	}
+	return p, validProtocol(p)
+}
+
+// endpointFromEnv reports whether the exporter for a signal will pick its
+// endpoint up from the environment, in which case Config.Endpoint must not
+// be passed as an option (explicit options win over the environment).
+func endpointFromEnv(signalKey string) bool {
+	return os.Getenv(envEndpoint) != "" || os.Getenv(signalKey) != ""
+}
+
+// newPropagator builds the composite propagator for the given
+// OTEL_PROPAGATORS names. Every propagator injects its headers; on extract
+// the last one in the list that finds a valid context wins, so put the
+// preferred format last.
+func newPropagator(names []string) (propagation.TextMapPropagator, error) {
+	var props []propagation.TextMapPropagator
+	for _, name := range names {
+		switch name = strings.TrimSpace(name); name {
+		case "tracecontext":
+			props = append(props, propagation.TraceContext{})
+		case "baggage":
+			props = append(props, propagation.Baggage{})
+		case "b3":
+			props = append(props, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case "b3multi":
+			props = append(props, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "jaeger":
+			props = append(props, jaeger.Jaeger{})
+		case "xray":
+			props = append(props, xray.Propagator{})
+		case "none":
+			return propagation.NewCompositeTextMapPropagator(), nil
+		case "":
+		default:
+			return nil, fmt.Errorf("unsupported %s value %q", envPropagators, name)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(props...), nil
+}
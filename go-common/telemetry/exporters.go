@@ -0,0 +1,217 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/nutslove/otel-instrumentation-demo/go-common/otlpjson"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/otlpqueue"
+)
+
+// OTLP transport protocols, as spelled in OTEL_EXPORTER_OTLP_PROTOCOL.
+const (
+	ProtocolHTTPProtobuf = "http/protobuf"
+	ProtocolHTTPJSON     = "http/json"
+	ProtocolGRPC         = "grpc"
+)
+
+func newTraceExporter(ctx context.Context, cfg Config, queue *otlpqueue.Queue) (sdktrace.SpanExporter, error) {
+	if queue != nil {
+		return otlptrace.New(ctx, queue.TraceClient())
+	}
+
+	fromEnv := endpointFromEnv(envTracesEndpoint)
+
+	switch cfg.TracesProtocol {
+	case ProtocolGRPC:
+		var opts []otlptracegrpc.Option
+		if !fromEnv {
+			endpoint, insecure := parseEndpoint(cfg.GRPCEndpoint, DefaultGRPCEndpoint)
+			opts = append(opts, otlptracegrpc.WithEndpoint(endpoint))
+			if insecure {
+				opts = append(opts, otlptracegrpc.WithInsecure())
+			}
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case ProtocolHTTPJSON:
+		return otlptrace.New(ctx, otlpjson.NewTraceClient(jsonConfig(cfg, "TRACES", "/v1/traces")))
+	default:
+		var opts []otlptracehttp.Option
+		if !fromEnv {
+			endpoint, insecure := parseEndpoint(cfg.Endpoint, DefaultEndpoint)
+			opts = append(opts, otlptracehttp.WithEndpoint(endpoint))
+			if insecure {
+				opts = append(opts, otlptracehttp.WithInsecure())
+			}
+		}
+		return otlptracehttp.New(ctx, opts...)
+	}
+}
+
+func newMetricExporter(ctx context.Context, cfg Config, queue *otlpqueue.Queue) (sdkmetric.Exporter, error) {
+	if queue != nil {
+		return queue.MetricExporter(), nil
+	}
+
+	fromEnv := endpointFromEnv(envMetricsEndpoint)
+
+	switch cfg.MetricsProtocol {
+	case ProtocolGRPC:
+		var opts []otlpmetricgrpc.Option
+		if !fromEnv {
+			endpoint, insecure := parseEndpoint(cfg.GRPCEndpoint, DefaultGRPCEndpoint)
+			opts = append(opts, otlpmetricgrpc.WithEndpoint(endpoint))
+			if insecure {
+				opts = append(opts, otlpmetricgrpc.WithInsecure())
+			}
+		}
+		return otlpmetricgrpc.New(ctx, opts...)
+	case ProtocolHTTPJSON:
+		return otlpjson.NewMetricExporter(jsonConfig(cfg, "METRICS", "/v1/metrics")), nil
+	default:
+		var opts []otlpmetrichttp.Option
+		if !fromEnv {
+			endpoint, insecure := parseEndpoint(cfg.Endpoint, DefaultEndpoint)
+			opts = append(opts, otlpmetrichttp.WithEndpoint(endpoint))
+			if insecure {
+				opts = append(opts, otlpmetrichttp.WithInsecure())
+			}
+		}
+		return otlpmetrichttp.New(ctx, opts...)
+	}
+}
+
+func newLogExporter(ctx context.Context, cfg Config, queue *otlpqueue.Queue) (sdklog.Exporter, error) {
+	if queue != nil {
+		return queue.LogExporter(), nil
+	}
+
+	fromEnv := endpointFromEnv(envLogsEndpoint)
+
+	switch cfg.LogsProtocol {
+	case ProtocolGRPC:
+		var opts []otlploggrpc.Option
+		if !fromEnv {
+			endpoint, insecure := parseEndpoint(cfg.GRPCEndpoint, DefaultGRPCEndpoint)
+			opts = append(opts, otlploggrpc.WithEndpoint(endpoint))
+			if insecure {
+				opts = append(opts, otlploggrpc.WithInsecure())
+			}
+		}
+		return otlploggrpc.New(ctx, opts...)
+	case ProtocolHTTPJSON:
+		return otlpjson.NewLogExporter(jsonConfig(cfg, "LOGS", "/v1/logs")), nil
+	default:
+		var opts []otlploghttp.Option
+		if !fromEnv {
+			endpoint, insecure := parseEndpoint(cfg.Endpoint, DefaultEndpoint)
+			opts = append(opts, otlploghttp.WithEndpoint(endpoint))
+			if insecure {
+				opts = append(opts, otlploghttp.WithInsecure())
+			}
+		}
+		return otlploghttp.New(ctx, opts...)
+	}
+}
+
+// newQueue opens the export queue of signal when cfg.QueueDir is set, and
+// returns nil otherwise.
+func (t *Telemetry) newQueue(cfg Config, signal, protocol string) (*otlpqueue.Queue, error) {
+	if cfg.QueueDir == "" {
+		return nil, nil
+	}
+	if protocol == ProtocolGRPC {
+		return nil, fmt.Errorf("the export queue cannot send %s over %s", signal, protocol)
+	}
+	q, err := otlpqueue.New(signal, otlpqueue.Config{
+		Dir:      filepath.Join(cfg.QueueDir, signal),
+		MaxBytes: cfg.QueueMaxBytes,
+		Target:   jsonConfig(cfg, strings.ToUpper(signal), "/v1/"+signal),
+		JSON:     protocol == ProtocolHTTPJSON,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s export queue: %w", signal, err)
+	}
+	t.queues = append(t.queues, q)
+	return q, nil
+}
+
+// jsonConfig resolves the URL, headers and timeout for the http/json
+// exporters and the export queue from the same variables the upstream HTTP
+// exporters read.
+func jsonConfig(cfg Config, signal, path string) otlpjson.Config {
+	var jc otlpjson.Config
+
+	switch {
+	case os.Getenv("OTEL_EXPORTER_OTLP_"+signal+"_ENDPOINT") != "":
+		jc.URL = os.Getenv("OTEL_EXPORTER_OTLP_" + signal + "_ENDPOINT")
+	case os.Getenv(envEndpoint) != "":
+		jc.URL = strings.TrimSuffix(os.Getenv(envEndpoint), "/") + path
+	default:
+		endpoint, insecure := parseEndpoint(cfg.Endpoint, DefaultEndpoint)
+		scheme := "https"
+		if insecure {
+			scheme = "http"
+		}
+		jc.URL = scheme + "://" + endpoint + path
+	}
+
+	jc.Headers = parseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"))
+	for k, v := range parseHeaders(os.Getenv("OTEL_EXPORTER_OTLP_" + signal + "_HEADERS")) {
+		jc.Headers[k] = v
+	}
+
+	timeout := os.Getenv("OTEL_EXPORTER_OTLP_" + signal + "_TIMEOUT")
+	if timeout == "" {
+		timeout = os.Getenv("OTEL_EXPORTER_OTLP_TIMEOUT")
+	}
+	if ms, err := strconv.Atoi(timeout); err == nil && ms > 0 {
+		jc.Timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	return jc
+}
+
+// parseHeaders decodes the "k1=v1,k2=v2" format of OTEL_EXPORTER_OTLP_HEADERS.
+func parseHeaders(s string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		k, errK := url.PathUnescape(strings.TrimSpace(k))
+		v, errV := url.PathUnescape(strings.TrimSpace(v))
+		if errK != nil || errV != nil || k == "" {
+			continue
+		}
+		headers[k] = v
+	}
+	return headers
+}
+
+func validProtocol(p string) error {
+	switch p {
+	case ProtocolHTTPProtobuf, ProtocolHTTPJSON, ProtocolGRPC:
+		return nil
+	default:
+		return fmt.Errorf("unsupported OTLP protocol %q", p)
+	}
+}
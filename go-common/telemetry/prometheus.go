@@ -0,0 +1,81 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// DefaultPrometheusAddr is where the /metrics endpoint listens when
+// Config.PrometheusAddr is empty. The port matches the Java agent's; the
+// host is left open (the spec's default is localhost) so the endpoint can be
+// scraped from other containers.
+const DefaultPrometheusAddr = ":9464"
+
+const (
+	envPrometheusHost = "OTEL_EXPORTER_PROMETHEUS_HOST"
+	envPrometheusPort = "OTEL_EXPORTER_PROMETHEUS_PORT"
+)
+
+// prometheusServer exposes a Prometheus exporter's registry over HTTP.
+type prometheusServer struct {
+	srv *http.Server
+}
+
+// newPrometheusReader creates a Prometheus exporter with its own registry
+// and starts serving it under /metrics on addr. The listener is opened
+// before returning so that a port conflict fails New.
+func newPrometheusReader(addr string, producers ...sdkmetric.Producer) (*otelprom.Exporter, *prometheusServer, error) {
+	reg := prometheus.NewRegistry()
+	opts := []otelprom.Option{otelprom.WithRegisterer(reg)}
+	for _, p := range producers {
+		opts = append(opts, otelprom.WithProducer(p))
+	}
+	exporter, err := otelprom.New(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	// OpenMetrics is what carries exemplars to the scraper.
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go srv.Serve(ln)
+
+	return exporter, &prometheusServer{srv: srv}, nil
+}
+
+func (p *prometheusServer) Shutdown(ctx context.Context) error {
+	return p.srv.Shutdown(ctx)
+}
+
+// prometheusAddr applies OTEL_EXPORTER_PROMETHEUS_HOST and _PORT to addr.
+func prometheusAddr(addr string) (string, error) {
+	if addr == "" {
+		addr = DefaultPrometheusAddr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid Prometheus address %q: %w", addr, err)
+	}
+	if v := os.Getenv(envPrometheusHost); v != "" {
+		host = v
+	}
+	if v := os.Getenv(envPrometheusPort); v != "" {
+		port = v
+	}
+	return net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,171 @@
+package telemetry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Sampler names, as spelled in OTEL_TRACES_SAMPLER. The rate limiting ones
+// are specific to this package; their argument is the number of spans per
+// second to keep.
+const (
+	SamplerAlwaysOn                = "always_on"
+	SamplerAlwaysOff               = "always_off"
+	SamplerTraceIDRatio            = "traceidratio"
+	SamplerRateLimiting            = "ratelimiting"
+	SamplerParentBasedAlwaysOn     = "parentbased_always_on"
+	SamplerParentBasedAlwaysOff    = "parentbased_always_off"
+	SamplerParentBasedTraceIDRatio = "parentbased_traceidratio"
+	SamplerParentBasedRateLimiting = "parentbased_ratelimiting"
+)
+
+// DefaultSampler matches the SDK's own default.
+const DefaultSampler = SamplerParentBasedAlwaysOn
+
+const defaultRateLimit = 100
+
+// NewSampler builds the sampler called name. arg is the ratio for the
+// traceidratio samplers and the spans-per-second limit for the rate limiting
+// ones; an empty arg selects the default (1.0 and 100 respectively).
+func NewSampler(name, arg string) (sdktrace.Sampler, error) {
+	root, parentBased := strings.CutPrefix(name, "parentbased_")
+
+	var s sdktrace.Sampler
+	switch root {
+	case SamplerAlwaysOn:
+		s = sdktrace.AlwaysSample()
+	case SamplerAlwaysOff:
+		s = sdktrace.NeverSample()
+	case SamplerTraceIDRatio:
+		ratio, err := parseSamplerArg(arg, 1.0)
+		if err != nil {
+			return nil, err
+		}
+		if ratio < 0 || ratio > 1 {
+			return nil, fmt.Errorf("sampler ratio %v out of range [0, 1]", ratio)
+		}
+		s = sdktrace.TraceIDRatioBased(ratio)
+	case SamplerRateLimiting:
+		limit, err := parseSamplerArg(arg, defaultRateLimit)
+		if err != nil {
+			return nil, err
+		}
+		if limit < 0 {
+			return nil, fmt.Errorf("sampler rate limit %v must not be negative", limit)
+		}
+		s = newRateLimitingSampler(limit)
+	default:
+		return nil, fmt.Errorf("unsupported sampler %q", name)
+	}
+
+	if parentBased {
+		s = sdktrace.ParentBased(s)
+	}
+	return s, nil
+}
+
+func parseSamplerArg(arg string, def float64) (float64, error) {
+	if arg = strings.TrimSpace(arg); arg == "" {
+		return def, nil
+	}
+	v, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid sampler argument %q: %w", arg, err)
+	}
+	return v, nil
+}
+
+// ReloadableSampler delegates to a sampler that can be swapped at runtime,
+// e.g. from an admin endpoint, without rebuilding the TracerProvider.
+type ReloadableSampler struct {
+	mu      sync.RWMutex
+	name    string
+	arg     string
+	current sdktrace.Sampler
+}
+
+// NewReloadableSampler returns a ReloadableSampler starting with NewSampler(name, arg).
+func NewReloadableSampler(name, arg string) (*ReloadableSampler, error) {
+	s := &ReloadableSampler{}
+	if err := s.Update(name, arg); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Update replaces the active sampler. On error the previous one stays active.
+func (s *ReloadableSampler) Update(name, arg string) error {
+	next, err := NewSampler(name, arg)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.name, s.arg, s.current = name, arg, next
+	s.mu.Unlock()
+	return nil
+}
+
+// Config returns the name and argument of the active sampler.
+func (s *ReloadableSampler) Config() (name, arg string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.name, s.arg
+}
+
+func (s *ReloadableSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	s.mu.RLock()
+	current := s.current
+	s.mu.RUnlock()
+	return current.ShouldSample(p)
+}
+
+func (s *ReloadableSampler) Description() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current.Description()
+}
+
+// rateLimitingSampler keeps at most limit spans per second using a token
+// bucket that holds up to one second worth of tokens (at least one).
+type rateLimitingSampler struct {
+	mu       sync.Mutex
+	limit    float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
+}
+
+func newRateLimitingSampler(limit float64) *rateLimitingSampler {
+	capacity := max(limit, 1)
+	return &rateLimitingSampler{limit: limit, capacity: capacity, tokens: limit, last: time.Now(), now: time.Now}
+}
+
+func (s *rateLimitingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	psc := trace.SpanContextFromContext(p.ParentContext)
+	result := sdktrace.SamplingResult{Tracestate: psc.TraceState()}
+
+	s.mu.Lock()
+	now := s.now()
+	s.tokens = min(s.capacity, s.tokens+now.Sub(s.last).Seconds()*s.limit)
+	s.last = now
+	if s.tokens >= 1 {
+		s.tokens--
+		result.Decision = sdktrace.RecordAndSample
+	} else {
+		result.Decision = sdktrace.Drop
+	}
+	s.mu.Unlock()
+
+	return result
+}
+
+func (s *rateLimitingSampler) Description() string {
+	return fmt.Sprintf("RateLimitingSampler{%g}", s.limit)
+}
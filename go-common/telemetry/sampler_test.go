@@ -0,0 +1,240 @@
+package telemetry
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sample asks s for a decision on a root span, or on a child of parent
+// when parent is valid.
+func sample(s sdktrace.Sampler, parent trace.SpanContext) sdktrace.SamplingDecision {
+	ctx := context.Background()
+	if parent.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, parent)
+	}
+	traceID := trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36}
+	return s.ShouldSample(sdktrace.SamplingParameters{ParentContext: ctx, TraceID: traceID, Name: "GET /pricing"}).Decision
+}
+
+// remoteParent returns a remote parent span context, sampled or not.
+func remoteParent(sampled bool) trace.SpanContext {
+	var flags trace.TraceFlags
+	if sampled {
+		flags = trace.FlagsSampled
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{1},
+		TraceFlags: flags,
+		Remote:     true,
+	})
+}
+
+func TestNewSampler(t *testing.T) {
+	for _, tt := range []struct {
+		name, arg string
+		want      string
+	}{
+		{name: SamplerAlwaysOn, want: "AlwaysOnSampler"},
+		{name: SamplerAlwaysOff, want: "AlwaysOffSampler"},
+		{name: SamplerTraceIDRatio, want: "AlwaysOnSampler"}, // the SDK shortcut for ratio 1
+		{name: SamplerTraceIDRatio, arg: " 0.25 ", want: "TraceIDRatioBased{0.25}"},
+		{name: SamplerRateLimiting, want: "RateLimitingSampler{100}"},
+		{name: SamplerRateLimiting, arg: "20", want: "RateLimitingSampler{20}"},
+		{name: SamplerParentBasedAlwaysOn, want: sdktrace.ParentBased(sdktrace.AlwaysSample()).Description()},
+		{name: SamplerParentBasedAlwaysOff, want: sdktrace.ParentBased(sdktrace.NeverSample()).Description()},
+		{name: SamplerParentBasedTraceIDRatio, arg: "0.5", want: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(0.5)).Description()},
+		{name: SamplerParentBasedRateLimiting, arg: "5", want: sdktrace.ParentBased(newRateLimitingSampler(5)).Description()},
+	} {
+		s, err := NewSampler(tt.name, tt.arg)
+		if err != nil {
+			t.Errorf("NewSampler(%q, %q): %v", tt.name, tt.arg, err)
+			continue
+		}
+		if got := s.Description(); got != tt.want {
+			t.Errorf("NewSampler(%q, %q) = %s, want %s", tt.name, tt.arg, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct{ name, arg string }{
+		{name: ""},
+		{name: "parentbased_"},
+		{name: "jaeger_remote"},
+		{name: "AlwaysOn"},
+		{name: SamplerTraceIDRatio, arg: "half"},
+		{name: SamplerTraceIDRatio, arg: "1.5"},
+		{name: SamplerParentBasedTraceIDRatio, arg: "-0.1"},
+		{name: SamplerRateLimiting, arg: "-1"},
+	} {
+		if _, err := NewSampler(tt.name, tt.arg); err == nil {
+			t.Errorf("NewSampler(%q, %q): want an error", tt.name, tt.arg)
+		}
+	}
+}
+
+func TestSamplerDecisions(t *testing.T) {
+	var none trace.SpanContext
+	for _, tt := range []struct {
+		name, arg string
+		parent    trace.SpanContext
+		want      sdktrace.SamplingDecision
+	}{
+		{name: SamplerAlwaysOn, parent: remoteParent(false), want: sdktrace.RecordAndSample},
+		{name: SamplerAlwaysOff, parent: remoteParent(true), want: sdktrace.Drop},
+		{name: SamplerTraceIDRatio, arg: "0", parent: none, want: sdktrace.Drop},
+		{name: SamplerTraceIDRatio, arg: "1", parent: none, want: sdktrace.RecordAndSample},
+		{name: SamplerRateLimiting, arg: "0", parent: none, want: sdktrace.Drop},
+
+		// parentbased_* follow the parent's decision and use the root
+		// sampler only without a parent
+		{name: SamplerParentBasedAlwaysOn, parent: none, want: sdktrace.RecordAndSample},
+		{name: SamplerParentBasedAlwaysOn, parent: remoteParent(false), want: sdktrace.Drop},
+		{name: SamplerParentBasedAlwaysOff, parent: none, want: sdktrace.Drop},
+		{name: SamplerParentBasedAlwaysOff, parent: remoteParent(true), want: sdktrace.RecordAndSample},
+		{name: SamplerParentBasedTraceIDRatio, arg: "0", parent: none, want: sdktrace.Drop},
+		{name: SamplerParentBasedTraceIDRatio, arg: "0", parent: remoteParent(true), want: sdktrace.RecordAndSample},
+		{name: SamplerParentBasedTraceIDRatio, arg: "1", parent: remoteParent(false), want: sdktrace.Drop},
+		{name: SamplerParentBasedRateLimiting, arg: "0", parent: none, want: sdktrace.Drop},
+		{name: SamplerParentBasedRateLimiting, arg: "0", parent: remoteParent(true), want: sdktrace.RecordAndSample},
+	} {
+		s, err := NewSampler(tt.name, tt.arg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := sample(s, tt.parent); got != tt.want {
+			t.Errorf("%s(%q) with parent %v: decision %v, want %v", tt.name, tt.arg, tt.parent.TraceFlags(), got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitingSampler(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		limit float64
+		// steps advance the clock by wait, then ask for decisions until
+		// the first Drop and expect sampled of them to be kept.
+		steps []struct {
+			wait    time.Duration
+			sampled int
+		}
+	}{
+		{
+			name:  "2 per second",
+			limit: 2,
+			steps: []struct {
+				wait    time.Duration
+				sampled int
+			}{
+				{0, 2}, // starts with a full bucket
+				{500 * time.Millisecond, 1},
+				{250 * time.Millisecond, 0}, // half a token
+				{250 * time.Millisecond, 1},
+				{10 * time.Second, 2}, // at most one second worth
+			},
+		},
+		{
+			name:  "below 1 per second",
+			limit: 0.5,
+			steps: []struct {
+				wait    time.Duration
+				sampled int
+			}{
+				{0, 0},
+				{time.Second, 1},
+				{time.Second, 0},
+				{time.Minute, 1}, // the bucket holds at least one token
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRateLimitingSampler(tt.limit)
+			now := s.last
+			s.now = func() time.Time { return now }
+
+			for i, step := range tt.steps {
+				now = now.Add(step.wait)
+				sampled := 0
+				for sample(s, trace.SpanContext{}) == sdktrace.RecordAndSample {
+					sampled++
+					if sampled > 100 {
+						t.Fatalf("step %d: never dropped", i)
+					}
+				}
+				if sampled != step.sampled {
+					t.Errorf("step %d (+%v): %d sampled, want %d", i, step.wait, sampled, step.sampled)
+				}
+			}
+		})
+	}
+}
+
+func TestReloadableSampler(t *testing.T) {
+	s, err := NewReloadableSampler(SamplerAlwaysOff, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sample(s, trace.SpanContext{}); got != sdktrace.Drop {
+		t.Errorf("always_off: decision %v", got)
+	}
+
+	if err := s.Update(SamplerTraceIDRatio, "2"); err == nil {
+		t.Error("Update with an invalid ratio: want an error")
+	}
+	if name, arg := s.Config(); name != SamplerAlwaysOff || arg != "" {
+		t.Errorf("after a failed Update, Config = %q, %q; want the previous sampler", name, arg)
+	}
+
+	if err := s.Update(SamplerParentBasedTraceIDRatio, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if name, arg := s.Config(); name != SamplerParentBasedTraceIDRatio || arg != "1" {
+		t.Errorf("Config = %q, %q", name, arg)
+	}
+	if got := sample(s, trace.SpanContext{}); got != sdktrace.RecordAndSample {
+		t.Errorf("parentbased_traceidratio(1): decision %v", got)
+	}
+}
+
+// TestReloadableSamplerConcurrent swaps the sampler while spans are being
+// sampled; run with -race.
+func TestReloadableSamplerConcurrent(t *testing.T) {
+	s, err := NewReloadableSampler(DefaultSampler, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	samplers := []struct{ name, arg string }{
+		{SamplerAlwaysOff, ""},
+		{SamplerParentBasedTraceIDRatio, "0.5"},
+		{SamplerRateLimiting, "10"},
+		{DefaultSampler, ""},
+	}
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := range 200 {
+				c := samplers[(i+j)%len(samplers)]
+				if err := s.Update(c.name, c.arg); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				sample(s, remoteParent(true))
+				s.Description()
+				s.Config()
+			}
+		}()
+	}
+	wg.Wait()
+}
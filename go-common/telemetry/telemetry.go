@@ -0,0 +1,385 @@
+// Package telemetry builds the OpenTelemetry providers shared by the Go
+// pricing services, so exporter and resource setup lives in one place.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/contrib/zpages"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+
+	"github.com/nutslove/otel-instrumentation-demo/go-common/hostmetrics"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/otlpqueue"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/runtimemetrics"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/semconvcompat"
+)
+
+// Collector addresses used when Config.Endpoint / Config.GRPCEndpoint are empty.
+const (
+	DefaultEndpoint     = "localhost:4318"
+	DefaultGRPCEndpoint = "localhost:4317"
+)
+
+// Config describes which signals to export and where to send them. The
+// values act as defaults: the standard OTEL_* environment variables
+// (OTEL_SERVICE_NAME, OTEL_RESOURCE_ATTRIBUTES, OTEL_EXPORTER_OTLP_*,
+// OTEL_PROPAGATORS, OTEL_BSP_*, ...) take precedence when set.
+// OTEL_SEMCONV_STABILITY_OPT_IN selects the HTTP and database attribute
+// names that are exported (see package semconvcompat).
+type Config struct {
+	ServiceName    string
+	ServiceVersion string
+
+	// Endpoint is the OTLP/HTTP collector address. Both "host:port" and
+	// "http(s)://host:port" are accepted; an https scheme enables TLS.
+	Endpoint string
+	// GRPCEndpoint is the same for signals exported over OTLP/gRPC.
+	GRPCEndpoint string
+
+	// Protocol selects the OTLP transport for every signal: http/protobuf
+	// (default), http/json or grpc. The per-signal fields override it.
+	Protocol        string
+	TracesProtocol  string
+	MetricsProtocol string
+	LogsProtocol    string
+
+	// BatchTimeout overrides the span batcher's export delay (SDK default: 5s).
+	BatchTimeout time.Duration
+
+	// Sampler and SamplerArg select the head sampler (see NewSampler);
+	// OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG override them.
+	Sampler    string
+	SamplerArg string
+
+	// Propagators lists OTEL_PROPAGATORS names (default: tracecontext):
+	// tracecontext, baggage, b3 (single header), b3multi, jaeger, xray or
+	// none.
+	Propagators []string
+
+	// IDGenerator replaces the SDK's random trace and span IDs, e.g. with
+	// X-Ray's time-prefixed trace IDs. Nil keeps the SDK default.
+	IDGenerator sdktrace.IDGenerator
+
+	// Detectors add platform attributes (ECS task, cloud region, ...) to the
+	// resource. Service name and version, OTEL_SERVICE_NAME and
+	// OTEL_RESOURCE_ATTRIBUTES take precedence over what they detect.
+	Detectors []resource.Detector
+
+	// Traces, Metrics and Logs turn OTLP export of the corresponding signal
+	// on. OTEL_{TRACES,METRICS,LOGS}_EXPORTER=none switches one off again.
+	Traces  bool
+	Metrics bool
+	Logs    bool
+
+	// Prometheus additionally serves the metrics for scraping under
+	// /metrics on PrometheusAddr (default DefaultPrometheusAddr).
+	// OTEL_METRICS_EXPORTER may list "prometheus" next to or instead of
+	// "otlp"; OTEL_EXPORTER_PROMETHEUS_HOST and _PORT override the address.
+	Prometheus     bool
+	PrometheusAddr string
+
+	// RuntimeMetrics records Go runtime metrics (memory, GC, goroutines,
+	// scheduler latency) and HostMetrics process and host metrics (CPU,
+	// memory, threads, file descriptors, network) on the MeterProvider.
+	RuntimeMetrics bool
+	HostMetrics    bool
+
+	// QueueDir turns on the persistent export queue (see package
+	// otlpqueue): OTLP exports are written to a directory per signal below
+	// QueueDir and sent from there, retrying until the collector accepts
+	// them, so collector restarts leave no gaps. QueueMaxBytes bounds each
+	// signal's directory (default otlpqueue.DefaultMaxBytes). Signals
+	// exported over grpc cannot be queued.
+	QueueDir      string
+	QueueMaxBytes int64
+
+	// Tracez keeps the in-flight spans and samples of the recent ones,
+	// by span name, latency bucket and error, in memory and serves them
+	// as an HTML page through Telemetry.TracezHandler.
+	Tracez bool
+}
+
+// Telemetry holds the providers created by New. Providers for disabled
+// signals are nil; the global no-op implementation stays in place for them.
+type Telemetry struct {
+	TracerProvider *sdktrace.TracerProvider
+	MeterProvider  *sdkmetric.MeterProvider
+	LoggerProvider *sdklog.LoggerProvider
+
+	// Sampler is the TracerProvider's sampler; Update changes it at runtime.
+	Sampler *ReloadableSampler
+
+	// TracezHandler serves the zPages trace page when Config.Tracez is set
+	// and is nil otherwise.
+	TracezHandler http.Handler
+
+	prometheus *prometheusServer
+	queues     []*otlpqueue.Queue
+}
+
+// New creates the enabled providers and registers them as the globals.
+func New(ctx context.Context, cfg Config) (*Telemetry, error) {
+	cfg, err := applyEnv(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Propagators) == 0 {
+		cfg.Propagators = []string{"tracecontext"}
+	}
+	propagator, err := newPropagator(cfg.Propagators)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Sampler == "" {
+		cfg.Sampler = DefaultSampler
+	}
+	sampler, err := NewReloadableSampler(cfg.Sampler, cfg.SamplerArg)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Telemetry{Sampler: sampler}
+
+	if cfg.Traces {
+		queue, err := t.newQueue(cfg, otlpqueue.Traces, cfg.TracesProtocol)
+		if err != nil {
+			t.Shutdown(ctx)
+			return nil, err
+		}
+		traceExporter, err := newTraceExporter(ctx, cfg, queue)
+		if err != nil {
+			t.Shutdown(ctx)
+			return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+		}
+
+		var batchOpts []sdktrace.BatchSpanProcessorOption
+		if cfg.BatchTimeout > 0 {
+			batchOpts = append(batchOpts, sdktrace.WithBatchTimeout(cfg.BatchTimeout))
+		}
+		tracerOpts := []sdktrace.TracerProviderOption{
+			// OTEL_SEMCONV_STABILITY_OPT_IN picks the attribute names exported
+			sdktrace.WithBatcher(semconvcompat.SpanExporter(traceExporter), batchOpts...),
+			sdktrace.WithSampler(sampler),
+			sdktrace.WithResource(res),
+		}
+		if cfg.IDGenerator != nil {
+			tracerOpts = append(tracerOpts, sdktrace.WithIDGenerator(cfg.IDGenerator))
+		}
+		if cfg.Tracez {
+			// Next to the batcher, so the page shows what the process
+			// produced regardless of what happens to it downstream
+			tracez := zpages.NewSpanProcessor()
+			tracerOpts = append(tracerOpts, sdktrace.WithSpanProcessor(tracez))
+			t.TracezHandler = zpages.NewTracezHandler(tracez)
+		}
+		t.TracerProvider = sdktrace.NewTracerProvider(tracerOpts...)
+		otel.SetTracerProvider(t.TracerProvider)
+	}
+
+	// Set even without traces so that baggage and incoming trace context
+	// still reach downstream services.
+	otel.SetTextMapPropagator(propagator)
+
+	if err := t.initMetrics(ctx, cfg, res); err != nil {
+		t.Shutdown(ctx)
+		return nil, err
+	}
+	if t.MeterProvider != nil {
+		otel.SetMeterProvider(t.MeterProvider)
+	}
+
+	if cfg.Logs {
+		queue, err := t.newQueue(cfg, otlpqueue.Logs, cfg.LogsProtocol)
+		if err != nil {
+			t.Shutdown(ctx)
+			return nil, err
+		}
+		logExporter, err := newLogExporter(ctx, cfg, queue)
+		if err != nil {
+			t.Shutdown(ctx)
+			return nil, fmt.Errorf("failed to create log exporter: %w", err)
+		}
+
+		t.LoggerProvider = sdklog.NewLoggerProvider(
+			sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)),
+			sdklog.WithResource(res),
+		)
+		global.SetLoggerProvider(t.LoggerProvider)
+	}
+
+	if t.MeterProvider != nil && len(t.queues) > 0 {
+		if err := otlpqueue.RegisterMetrics(t.MeterProvider, t.queues...); err != nil {
+			t.Shutdown(ctx)
+			return nil, fmt.Errorf("failed to register export queue metrics: %w", err)
+		}
+	}
+
+	return t, nil
+}
+
+// NewMeterProvider creates the MeterProvider of cfg alone, for services
+// whose spans are recorded outside the process, and returns it with its
+// shutdown function. cfg.Traces and cfg.Logs are ignored and nothing is
+// registered as a global. When cfg and OTEL_METRICS_EXPORTER leave metrics
+// off, the MeterProvider is a no-op one.
+func NewMeterProvider(ctx context.Context, cfg Config) (metric.MeterProvider, func(context.Context) error, error) {
+	cfg, err := applyEnv(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.Traces, cfg.Logs = false, false
+
+	res, err := newResource(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	t := &Telemetry{}
+	if err := t.initMetrics(ctx, cfg, res); err != nil {
+		t.Shutdown(ctx)
+		return nil, nil, err
+	}
+	if t.MeterProvider == nil {
+		return noop.NewMeterProvider(), t.Shutdown, nil
+	}
+	if len(t.queues) > 0 {
+		if err := otlpqueue.RegisterMetrics(t.MeterProvider, t.queues...); err != nil {
+			t.Shutdown(ctx)
+			return nil, nil, fmt.Errorf("failed to register export queue metrics: %w", err)
+		}
+	}
+	return t.MeterProvider, t.Shutdown, nil
+}
+
+// initMetrics creates the MeterProvider when cfg exports metrics, and
+// starts the runtime and host metrics on it.
+func (t *Telemetry) initMetrics(ctx context.Context, cfg Config, res *resource.Resource) error {
+	if !cfg.Metrics && !cfg.Prometheus {
+		return nil
+	}
+
+	meterOpts := []sdkmetric.Option{
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(semconvcompat.Views()...),
+	}
+
+	// go.schedule.duration is a histogram computed by the runtime, so it
+	// is handed to the readers as precomputed data.
+	var producers []sdkmetric.Producer
+	if cfg.RuntimeMetrics {
+		producers = append(producers, runtime.NewProducer())
+	}
+
+	if cfg.Metrics {
+		queue, err := t.newQueue(cfg, otlpqueue.Metrics, cfg.MetricsProtocol)
+		if err != nil {
+			return err
+		}
+		metricExporter, err := newMetricExporter(ctx, cfg, queue)
+		if err != nil {
+			return fmt.Errorf("failed to create metric exporter: %w", err)
+		}
+		var readerOpts []sdkmetric.PeriodicReaderOption
+		for _, p := range producers {
+			readerOpts = append(readerOpts, sdkmetric.WithProducer(p))
+		}
+		meterOpts = append(meterOpts, sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter, readerOpts...)))
+	}
+
+	if cfg.Prometheus {
+		promExporter, promServer, err := newPrometheusReader(cfg.PrometheusAddr, producers...)
+		if err != nil {
+			return fmt.Errorf("failed to create Prometheus exporter: %w", err)
+		}
+		t.prometheus = promServer
+		meterOpts = append(meterOpts, sdkmetric.WithReader(promExporter))
+	}
+
+	t.MeterProvider = sdkmetric.NewMeterProvider(meterOpts...)
+
+	if cfg.RuntimeMetrics {
+		if err := runtimemetrics.Start(t.MeterProvider); err != nil {
+			return fmt.Errorf("failed to start runtime metrics: %w", err)
+		}
+	}
+	if cfg.HostMetrics {
+		if err := hostmetrics.Start(t.MeterProvider); err != nil {
+			return fmt.Errorf("failed to start host metrics: %w", err)
+		}
+	}
+	return nil
+}
+
+// newResource returns the resource of every signal. OTEL_SERVICE_NAME and
+// OTEL_RESOURCE_ATTRIBUTES override the defaults.
+func newResource(ctx context.Context, cfg Config) (*resource.Resource, error) {
+	res, err := resource.New(ctx,
+		resource.WithDetectors(cfg.Detectors...),
+		resource.WithContainer(), // Add container information
+		resource.WithProcess(),   // Add process information
+		resource.WithAttributes(
+			semconv.ServiceName(cfg.ServiceName),
+			semconv.ServiceVersion(cfg.ServiceVersion),
+		),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+	return res, nil
+}
+
+// Shutdown flushes and stops every provider that was created.
+func (t *Telemetry) Shutdown(ctx context.Context) error {
+	var errs []error
+	if t.TracerProvider != nil {
+		errs = append(errs, t.TracerProvider.Shutdown(ctx))
+	}
+	if t.MeterProvider != nil {
+		errs = append(errs, t.MeterProvider.Shutdown(ctx))
+	}
+	if t.LoggerProvider != nil {
+		errs = append(errs, t.LoggerProvider.Shutdown(ctx))
+	}
+	if t.prometheus != nil {
+		errs = append(errs, t.prometheus.Shutdown(ctx))
+	}
+	// The providers shut their queues down; this covers a failed New.
+	for _, q := range t.queues {
+		errs = append(errs, q.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
+}
+
+// parseEndpoint strips an optional URL scheme from endpoint (def when
+// empty) and reports whether the exporters should skip TLS.
+func parseEndpoint(endpoint, def string) (string, bool) {
+	if endpoint == "" {
+		return def, true
+	}
+	if rest, ok := strings.CutPrefix(endpoint, "https://"); ok {
+		return strings.TrimSuffix(rest, "/"), false
+	}
+	rest, _ := strings.CutPrefix(endpoint, "http://")
+	return strings.TrimSuffix(rest, "/"), true
+}
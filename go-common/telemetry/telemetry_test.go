@@ -0,0 +1,310 @@
+package telemetry
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// setEnv clears every variable applyEnv reads, then sets env.
+func setEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for _, key := range []string{
+		envSDKDisabled, envTracesExporter, envMetricsExporter, envLogsExporter,
+		envPropagators, envSampler, envSamplerArg, envEndpoint, envProtocol,
+		envBSPScheduleDelay, envTracesProtocol, envMetricsProtocol, envLogsProtocol,
+		envPrometheusHost, envPrometheusPort,
+	} {
+		t.Setenv(key, "")
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	base := Config{
+		ServiceName:  "go-gin-service",
+		Traces:       true,
+		Metrics:      true,
+		Logs:         true,
+		Sampler:      "parentbased_always_on",
+		Propagators:  []string{"tracecontext"},
+		BatchTimeout: time.Second,
+	}
+	// defaults is base as applyEnv returns it without any environment.
+	defaults := func(c *Config) {
+		c.Protocol = ProtocolHTTPProtobuf
+		c.TracesProtocol = ProtocolHTTPProtobuf
+		c.MetricsProtocol = ProtocolHTTPProtobuf
+		c.LogsProtocol = ProtocolHTTPProtobuf
+	}
+
+	for _, tt := range []struct {
+		name string
+		cfg  func(*Config)
+		env  map[string]string
+		want func(*Config)
+	}{
+		{
+			name: "no environment",
+			want: defaults,
+		},
+		{
+			name: "exporters none",
+			env:  map[string]string{envTracesExporter: "none", envMetricsExporter: "none", envLogsExporter: " none "},
+			want: func(c *Config) {
+				defaults(c)
+				c.Traces, c.Metrics, c.Logs = false, false, false
+			},
+		},
+		{
+			name: "exporter otlp over Config",
+			cfg:  func(c *Config) { c.Logs = false },
+			env:  map[string]string{envLogsExporter: "otlp"},
+			want: func(c *Config) {
+				defaults(c)
+				c.Logs = true
+			},
+		},
+		{
+			name: "metrics prometheus only",
+			env:  map[string]string{envMetricsExporter: "prometheus"},
+			want: func(c *Config) {
+				defaults(c)
+				c.Metrics, c.Prometheus, c.PrometheusAddr = false, true, DefaultPrometheusAddr
+			},
+		},
+		{
+			name: "metrics otlp and prometheus",
+			env:  map[string]string{envMetricsExporter: "otlp, prometheus", envPrometheusHost: "127.0.0.1", envPrometheusPort: "9000"},
+			want: func(c *Config) {
+				defaults(c)
+				c.Prometheus, c.PrometheusAddr = true, "127.0.0.1:9000"
+			},
+		},
+		{
+			name: "metrics none in a list",
+			cfg:  func(c *Config) { c.Prometheus = true },
+			env:  map[string]string{envMetricsExporter: "otlp,none"},
+			want: func(c *Config) {
+				defaults(c)
+				c.Metrics, c.Prometheus = false, false
+			},
+		},
+		{
+			name: "SDK disabled",
+			cfg:  func(c *Config) { c.Prometheus = true },
+			env:  map[string]string{envSDKDisabled: "true", envTracesExporter: "otlp", envProtocol: "bogus"},
+			want: func(c *Config) {
+				c.Traces, c.Metrics, c.Logs, c.Prometheus = false, false, false, false
+			},
+		},
+		{
+			name: "SDK not disabled",
+			env:  map[string]string{envSDKDisabled: "false"},
+			want: defaults,
+		},
+		{
+			name: "protocols",
+			cfg:  func(c *Config) { c.LogsProtocol = ProtocolHTTPJSON },
+			env:  map[string]string{envProtocol: "grpc", envMetricsProtocol: "http/json"},
+			want: func(c *Config) {
+				c.Protocol = ProtocolGRPC
+				c.TracesProtocol = ProtocolGRPC
+				c.MetricsProtocol = ProtocolHTTPJSON
+				c.LogsProtocol = ProtocolHTTPJSON
+			},
+		},
+		{
+			name: "signal protocol over Config",
+			cfg:  func(c *Config) { c.Protocol, c.TracesProtocol = ProtocolGRPC, ProtocolGRPC },
+			env:  map[string]string{envTracesProtocol: "http/protobuf"},
+			want: func(c *Config) {
+				c.Protocol = ProtocolGRPC
+				c.TracesProtocol = ProtocolHTTPProtobuf
+				c.MetricsProtocol = ProtocolGRPC
+				c.LogsProtocol = ProtocolGRPC
+			},
+		},
+		{
+			name: "sampler",
+			env:  map[string]string{envSampler: "traceidratio", envSamplerArg: "0.25"},
+			want: func(c *Config) {
+				defaults(c)
+				c.Sampler, c.SamplerArg = "traceidratio", "0.25"
+			},
+		},
+		{
+			name: "sampler arg alone",
+			cfg:  func(c *Config) { c.SamplerArg = "1" },
+			env:  map[string]string{envSamplerArg: "0.25"},
+			want: defaults,
+		},
+		{
+			name: "propagators",
+			env:  map[string]string{envPropagators: "b3,tracecontext"},
+			want: func(c *Config) {
+				defaults(c)
+				c.Propagators = []string{"b3", "tracecontext"}
+			},
+		},
+		{
+			name: "batch delay from the environment",
+			env:  map[string]string{envBSPScheduleDelay: "200"},
+			want: func(c *Config) {
+				defaults(c)
+				c.BatchTimeout = 0
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+			cfg := base
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			want := cfg
+			tt.want(&want)
+
+			got, err := applyEnv(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("applyEnv =\n%+v\nwant\n%+v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyEnvErrors(t *testing.T) {
+	for _, env := range []map[string]string{
+		{envTracesExporter: "zipkin"},
+		{envMetricsExporter: "otlp,statsd"},
+		{envLogsExporter: "console"},
+		{envProtocol: "http"},
+		{envLogsProtocol: "grpc/json"},
+		// with Config.PrometheusAddr "localhost", which has no port
+		{envMetricsExporter: "prometheus"},
+	} {
+		setEnv(t, env)
+		cfg := Config{Traces: true, Metrics: true, Logs: true}
+		if env[envMetricsExporter] == "prometheus" {
+			cfg.PrometheusAddr = "localhost"
+		}
+		if _, err := applyEnv(cfg); err == nil {
+			t.Errorf("applyEnv with %v: want an error", env)
+		}
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want map[string]string
+	}{
+		{in: "", want: map[string]string{}},
+		{in: "api-key=secret,tenant=a", want: map[string]string{"api-key": "secret", "tenant": "a"}},
+		{in: " api-key = secret , tenant=a ", want: map[string]string{"api-key": "secret", "tenant": "a"}},
+		{in: "Authorization=Basic%20dXNlcjpwYXNz", want: map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}},
+		{in: "my%20key=a%2Cb%3Dc", want: map[string]string{"my key": "a,b=c"}},
+		{in: "k=a+b", want: map[string]string{"k": "a+b"}},
+		{in: "token=a=b", want: map[string]string{"token": "a=b"}},
+		{in: "novalue,=v,k=%zz,%zz=v,ok=1", want: map[string]string{"ok": "1"}},
+		{in: "k=", want: map[string]string{"k": ""}},
+	} {
+		if got := parseHeaders(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseHeaders(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewPropagator(t *testing.T) {
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+
+	for _, tt := range []struct {
+		names []string
+		want  []string // headers injected
+	}{
+		{names: []string{"tracecontext"}, want: []string{"traceparent"}},
+		{names: []string{"tracecontext", "baggage"}, want: []string{"traceparent"}},
+		{names: []string{"b3"}, want: []string{"b3"}},
+		{names: []string{"b3multi"}, want: []string{"x-b3-sampled", "x-b3-spanid", "x-b3-traceid"}},
+		{names: []string{"jaeger"}, want: []string{"uber-trace-id"}},
+		{names: []string{"xray"}, want: []string{"X-Amzn-Trace-Id"}},
+		{names: []string{" b3 ", "", "tracecontext"}, want: []string{"b3", "traceparent"}},
+		{names: []string{"none"}, want: []string{}},
+		{names: []string{"tracecontext", "none"}, want: []string{}},
+		{names: nil, want: []string{}},
+	} {
+		p, err := newPropagator(tt.names)
+		if err != nil {
+			t.Errorf("newPropagator(%q): %v", tt.names, err)
+			continue
+		}
+		carrier := propagation.MapCarrier{}
+		p.Inject(ctx, carrier)
+		got := carrier.Keys()
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("newPropagator(%q) injects %v, want %v", tt.names, got, tt.want)
+		}
+	}
+
+	for _, names := range [][]string{{"zipkin"}, {"tracecontext", "B3"}, {"ottrace"}} {
+		if _, err := newPropagator(names); err == nil {
+			t.Errorf("newPropagator(%q): want an error", names)
+		}
+	}
+}
+
+// TestNewPropagatorOrder checks that the last propagator finding a context
+// wins on extract.
+func TestNewPropagatorOrder(t *testing.T) {
+	const (
+		w3cTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		b3TraceID  = "80f198ee56343ba864fe8b2a57d3eff7"
+	)
+	carrier := propagation.MapCarrier{
+		"traceparent":  "00-" + w3cTraceID + "-00f067aa0ba902b7-01",
+		"b3":           b3TraceID + "-e457b5a2e4d86bd1-1",
+		"x-b3-traceid": b3TraceID,
+		"x-b3-spanid":  "e457b5a2e4d86bd1",
+		"x-b3-sampled": "1",
+	}
+	for _, tt := range []struct {
+		names []string
+		want  string
+	}{
+		{names: []string{"b3", "tracecontext"}, want: w3cTraceID},
+		{names: []string{"tracecontext", "b3"}, want: b3TraceID},
+		{names: []string{"tracecontext", "b3multi"}, want: b3TraceID},
+		// Both B3 encodings are extracted by either propagator
+		{names: []string{"b3multi"}, want: b3TraceID},
+		{names: []string{"jaeger", "xray"}, want: ""},
+	} {
+		p, err := newPropagator(tt.names)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc := trace.SpanContextFromContext(p.Extract(context.Background(), carrier))
+		got := ""
+		if sc.IsValid() {
+			got = sc.TraceID().String()
+		}
+		if got != tt.want {
+			t.Errorf("newPropagator(%q) extracts trace %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// Package tracelog correlates the logs of a service without an OpenTelemetry
+// SDK with the traces recorded outside of it (eBPF auto-instrumentation,
+// Envoy). There is no span of the service's own, so trace_id and span_id
+// come from the incoming request: span_id is the caller's span, which is the
+// parent of the server span in Tempo.
+//
+//	slog.SetDefault(slog.New(tracelog.NewHandler(slog.NewJSONHandler(os.Stdout, nil))))
+//	ctx := tracelog.Extract(r.Context(), r.Header)
+//	slog.InfoContext(ctx, "...") // {"msg":"...","trace_id":"...","span_id":"..."}
+//
+// The trace context is stored as the remote span context of ctx, so it is
+// also what trace.SpanContextFromContext returns for it. In a service with
+// an SDK, NewHandler logs the IDs of the service's own active span instead.
+package tracelog
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// propagator reads the B3 single and multi headers, then the W3C
+// traceparent, which takes precedence when both are valid. 64 bit B3 trace
+// IDs are left-padded, so that they match the IDs Tempo stores.
+var propagator = propagation.NewCompositeTextMapPropagator(b3.New(), propagation.TraceContext{})
+
+// Extract returns ctx with the trace context of the headers h: the W3C
+// traceparent, falling back to the B3 single header and then the X-B3-*
+// headers. ctx is returned unchanged when none of them is valid.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(h))
+}
+
+// NewHandler returns a slog.Handler adding trace_id and span_id to the
+// records logged with a context carrying a span context, then passing them
+// to h.
+func NewHandler(h slog.Handler) slog.Handler {
+	return handler{h}
+}
+
+type handler struct {
+	slog.Handler
+}
+
+func (h handler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r = r.Clone()
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return handler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h handler) WithGroup(name string) slog.Handler {
+	return handler{h.Handler.WithGroup(name)}
+}
+
+// NewMultiHandler returns a slog.Handler passing every record to each of
+// handlers that is enabled for its level, e.g. to log both through the OTel
+// bridge and as JSON to stdout. It is slog.NewMultiHandler from Go 1.26,
+// which the services cannot use while they build with Go 1.24.
+func NewMultiHandler(handlers ...slog.Handler) slog.Handler {
+	return multiHandler(handlers)
+}
+
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range m {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(multiHandler, len(m))
+	for i, h := range m {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	out := make(multiHandler, len(m))
+	for i, h := range m {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
@@ -0,0 +1,178 @@
+package tracelog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	w3cTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	w3cSpanID  = "00f067aa0ba902b7"
+	b3TraceID  = "80f198ee56343ba864fe8b2a57d3eff7"
+	b3SpanID   = "e457b5a2e4d86bd1"
+)
+
+func TestExtract(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		headers map[string]string
+		// want is "traceid-spanid-flags", empty for no trace context
+		want string
+	}{
+		{
+			name:    "traceparent",
+			headers: map[string]string{"traceparent": "00-" + w3cTraceID + "-" + w3cSpanID + "-01"},
+			want:    w3cTraceID + "-" + w3cSpanID + "-01",
+		},
+		{
+			name: "traceparent over b3",
+			headers: map[string]string{
+				"traceparent": "00-" + w3cTraceID + "-" + w3cSpanID + "-00",
+				"b3":          b3TraceID + "-" + b3SpanID + "-1",
+			},
+			want: w3cTraceID + "-" + w3cSpanID + "-00",
+		},
+		{
+			name: "invalid traceparent falls back to b3",
+			headers: map[string]string{
+				"traceparent": "00-" + w3cTraceID + "-0000000000000000-01",
+				"b3":          b3TraceID + "-" + b3SpanID + "-1",
+			},
+			want: b3TraceID + "-" + b3SpanID + "-01",
+		},
+		{
+			name: "x-b3 with 64 bit trace ID",
+			headers: map[string]string{
+				"x-b3-traceid": b3TraceID[16:],
+				"x-b3-spanid":  b3SpanID,
+				"x-b3-sampled": "1",
+			},
+			want: "0000000000000000" + b3TraceID[16:] + "-" + b3SpanID + "-01",
+		},
+		{
+			name:    "x-b3 debug",
+			headers: map[string]string{"x-b3-traceid": b3TraceID, "x-b3-spanid": b3SpanID, "x-b3-flags": "1"},
+			want:    b3TraceID + "-" + b3SpanID + "-01",
+		},
+		{
+			name:    "none",
+			headers: map[string]string{"x-request-id": "5f1f7a3c"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for name, v := range tt.headers {
+				h.Set(name, v)
+			}
+			sc := trace.SpanContextFromContext(Extract(context.Background(), h))
+			var got string
+			if sc.IsValid() {
+				got = sc.TraceID().String() + "-" + sc.SpanID().String() + "-" + sc.TraceFlags().String()
+			}
+			if got != tt.want {
+				t.Errorf("Extract() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewHandler(slog.NewJSONHandler(&buf, nil))).With("service", "test")
+
+	h := http.Header{}
+	h.Set("traceparent", "00-"+w3cTraceID+"-"+w3cSpanID+"-01")
+	logger.InfoContext(Extract(context.Background(), h), "with trace")
+	logger.InfoContext(context.Background(), "without trace")
+
+	dec := json.NewDecoder(&buf)
+	for _, want := range []map[string]string{
+		{"msg": "with trace", "service": "test", "trace_id": w3cTraceID, "span_id": w3cSpanID},
+		{"msg": "without trace", "service": "test"},
+	} {
+		var got map[string]any
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{"msg", "service", "trace_id", "span_id"} {
+			if v, _ := got[key].(string); v != want[key] {
+				t.Errorf("%s: %s = %q, want %q", want["msg"], key, v, want[key])
+			}
+		}
+	}
+}
+
+// failingHandler fails every record.
+type failingHandler struct{ slog.Handler }
+
+func (failingHandler) Handle(context.Context, slog.Record) error { return errors.New("handler failed") }
+
+func TestMultiHandler(t *testing.T) {
+	var info, warn bytes.Buffer
+	logger := slog.New(NewMultiHandler(
+		NewHandler(slog.NewJSONHandler(&info, nil)),
+		slog.NewJSONHandler(&warn, &slog.HandlerOptions{Level: slog.LevelWarn}),
+	)).With("service", "test").WithGroup("req")
+
+	h := http.Header{}
+	h.Set("traceparent", "00-"+w3cTraceID+"-"+w3cSpanID+"-01")
+	ctx := Extract(context.Background(), h)
+	logger.DebugContext(ctx, "debug", "id", 1)
+	logger.InfoContext(ctx, "info", "id", 2)
+	logger.WarnContext(ctx, "warn", "id", 3)
+
+	for _, tt := range []struct {
+		name string
+		buf  *bytes.Buffer
+		want []string // messages
+		// trace reports whether the records carry trace_id (in the req
+		// group, like every attribute added to the record). Only the first
+		// handler adds it; the second one gets a copy without it.
+		trace bool
+	}{
+		{name: "info", buf: &info, want: []string{"info", "warn"}, trace: true},
+		{name: "warn", buf: &warn, want: []string{"warn"}},
+	} {
+		dec := json.NewDecoder(tt.buf)
+		for _, msg := range tt.want {
+			var got map[string]any
+			if err := dec.Decode(&got); err != nil {
+				t.Fatalf("%s handler: %v", tt.name, err)
+			}
+			if got["msg"] != msg || got["service"] != "test" {
+				t.Errorf("%s handler: got %v, want msg %q with service", tt.name, got, msg)
+			}
+			if group, _ := got["req"].(map[string]any); group["id"] == nil {
+				t.Errorf("%s handler: %v has no req.id", tt.name, got)
+			}
+			if _, ok := got["req"].(map[string]any)["trace_id"]; ok != tt.trace {
+				t.Errorf("%s handler: %v, trace_id present: %v, want %v", tt.name, got, ok, tt.trace)
+			}
+		}
+		if dec.More() {
+			t.Errorf("%s handler: more records than %v", tt.name, tt.want)
+		}
+	}
+
+	m := NewMultiHandler(slog.NewJSONHandler(&info, &slog.HandlerOptions{Level: slog.LevelError}))
+	if m.Enabled(context.Background(), slog.LevelWarn) {
+		t.Error("Enabled(Warn) with a single Error handler")
+	}
+	if NewMultiHandler().Enabled(context.Background(), slog.LevelError) {
+		t.Error("Enabled without handlers")
+	}
+
+	err := NewMultiHandler(failingHandler{slog.NewJSONHandler(&info, nil)}, slog.NewJSONHandler(&warn, nil)).
+		Handle(context.Background(), slog.NewRecord(time.Now(), slog.LevelInfo, "msg", 0))
+	if err == nil {
+		t.Error("Handle: want the error of the failing handler")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"maps"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/nutslove/otel-instrumentation-demo/go-common/propcheck"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/propcheck/propchecktest"
+)
+
+// testRouter returns the service's handler on a fresh database.
+func testRouter(t *testing.T) http.Handler {
+	t.Helper()
+	if err := initDB(filepath.Join(t.TempDir(), "pricing.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	propagation, err := propcheck.New(propcheck.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := newRouter(propagation, noop.NewMeterProvider(), noop.NewMeterProvider())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return propagation.Handler(r)
+}
+
+func TestHeaderPropagation(t *testing.T) {
+	// headerprop copies every upstream header unchanged, so the Java spans
+	// join the caller's trace (docker-compose-envoy-propagation.yml)
+	want := propchecktest.UpstreamHeaders
+
+	propchecktest.Run(t, testRouter, []propchecktest.Case{
+		{Path: "/pricing/calculate", Status: http.StatusOK},
+		{Path: "/pricing/calculate/error", Status: http.StatusInternalServerError},
+		{Path: "/pricing/calculate/notify", Status: http.StatusOK},
+	}, func(t *testing.T, got map[string]string) {
+		if !maps.Equal(got, want) {
+			t.Errorf("headers reaching the Java service = %v, want %v", got, want)
+		}
+	})
+}
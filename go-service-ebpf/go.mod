@@ -1,8 +1,12 @@
 module go-pricing-service
 
-go 1.23
+go 1.24.0
 
 require (
-	github.com/gin-gonic/gin v1.9.1
-	github.com/mattn/go-sqlite3 v1.14.19
+	github.com/gin-gonic/gin v1.10.0
+	github.com/mattn/go-sqlite3 v1.14.24
+	github.com/nutslove/otel-instrumentation-demo/go-common v0.0.0
+	go.opentelemetry.io/otel/metric v1.39.0
 )
+
+replace github.com/nutslove/otel-instrumentation-demo/go-common => ../go-common
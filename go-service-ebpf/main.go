@@ -1,19 +1,25 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"github.com/gin-gonic/gin"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/nutslove/otel-instrumentation-demo/go-common/notification"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/propcheck"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/sqlcomment"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/telemetry"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/tracelog"
 )
 
 var db *sql.DB
@@ -28,16 +34,24 @@ type PricingResponse struct {
 	UnitPrice   float64 `json:"unit_price"`
 	Quantity    int     `json:"quantity"`
 	TotalPrice  float64 `json:"total_price"`
+	// Notification is the outcome of the notification to the Java service.
+	Notification *notification.Result `json:"notification,omitempty"`
 }
 
-func initDB() error {
-	var err error
-	db, err = sql.Open("sqlite3", "/data/pricing.db")
-	if err != nil {
-		return err
+func initDB(path string) error {
+	// Statements carry a sqlcommenter comment with the request's trace
+	// context and route; SQL_QUERY_LOG names a file logging them as sent.
+	var queryLog *sqlcomment.QueryLog
+	if path := os.Getenv("SQL_QUERY_LOG"); path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		queryLog = sqlcomment.NewQueryLog(f)
 	}
+	db = sqlcomment.Open(&sqlite3.SQLiteDriver{}, path, queryLog)
 
-	_, err = db.Exec(`
+	_, err := db.Exec(`
 		CREATE TABLE IF NOT EXISTS pricing (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			product_name TEXT NOT NULL UNIQUE,
@@ -58,17 +72,121 @@ func initDB() error {
 }
 
 func main() {
+	// JSON logs with trace_id/span_id of the incoming trace headers, as the
+	// service records no spans of its own
+	slog.SetDefault(slog.New(tracelog.NewHandler(slog.NewJSONHandler(os.Stdout, nil))))
+
+	// The eBPF agent records spans from outside the process, but no
+	// metrics. OTEL_METRICS_EXPORTER=otlp (or prometheus) turns on Go
+	// runtime, process and host metrics from a MeterProvider of the
+	// service's own, which propcheck and the notifier record on too
+	mp, shutdownMetrics, err := telemetry.NewMeterProvider(context.Background(), telemetry.Config{
+		ServiceName:    "go-gin-ebpf-service",
+		RuntimeMetrics: true,
+		HostMetrics:    true,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize metrics: %v", err)
+	}
+	defer shutdownMetrics(context.Background())
+
 	// Initialize database
-	if err := initDB(); err != nil {
+	if err := initDB("/data/pricing.db"); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
 
+	// Counts the requests whose trace is lost on the way to the Java service
+	propagation, err := propcheck.New(propcheck.Config{
+		Exclude:       []string{"/health", "/debug/"},
+		MeterProvider: mp,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize propagation check: %v", err)
+	}
+
+	r, err := newRouter(propagation, mp)
+	if err != nil {
+		log.Fatalf("Failed to set up router: %v", err)
+	}
+
+	// Start server
+	srv := &http.Server{
+		Addr:    ":8080",
+		Handler: propagation.Handler(r),
+	}
+
+	go func() {
+		log.Println("Go service listening on port 8080")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// Graceful shutdown
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Println("Shutting down server...")
+	if err := srv.Shutdown(nil); err != nil {
+		log.Fatalf("Server forced to shutdown: %v", err)
+	}
+}
+
+// notify sends n to the Java service and logs the outcome. A failed
+// notification does not fail the pricing request; the response reports it.
+func notify(ctx context.Context, notifier *notification.Client, n notification.Notification) notification.Result {
+	slog.InfoContext(ctx, fmt.Sprintf("Sending %s to: %s", n.Type, notifier.URL()))
+	res := notifier.Send(ctx, n)
+	if res.Status != notification.StatusSent {
+		slog.ErrorContext(ctx, fmt.Sprintf("Failed to send notification (%s after %d attempts): %s", res.Status, res.Attempts, res.Error))
+		return res
+	}
+	slog.InfoContext(ctx, fmt.Sprintf("Notification sent, response status: %d, body: %s", res.StatusCode, res.Body))
+	return res
+}
+
+// newRouter returns the service's routes and middleware. propagation serves
+// /debug/propagation; its Handler goes around the router. mp records the
+// notification client's metrics.
+func newRouter(propagation *propcheck.Checker, mp metric.MeterProvider) (*gin.Engine, error) {
 	// Setup Gin
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(gin.Recovery())
 
+	// Adds trace_id/span_id from the incoming trace headers to request logs
+	// and SQL comments
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(tracelog.Extract(c.Request.Context(), c.Request.Header))
+		c.Next()
+	})
+
+	// Adds the sqlcommenter route to the request's SQL statements
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(sqlcomment.ContextWithRoute(c.Request.Context(), c.FullPath()))
+		c.Next()
+	})
+
+	// Java serviceへの通知クライアント（タイムアウト・リトライ・サーキットブレーカー付き）
+	// 環境変数JAVA_SERVICE_URLで接続先を切り替え
+	// Envoy版: http://127.0.0.1:14318 (Envoy egress経由)
+	// それ以外: http://java-service:8081 (直接)
+	javaServiceURL := os.Getenv("JAVA_SERVICE_URL")
+	if javaServiceURL == "" {
+		javaServiceURL = "http://java-service:8081" // デフォルト
+	}
+	notifier, err := notification.New(notification.Config{
+		URL:           javaServiceURL,
+		Transport:     &propcheck.Transport{Base: notification.NewTransport()},
+		Logger:        slog.Default(),
+		MeterProvider: mp,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notification client: %w", err)
+	}
+
 	// CORS
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
@@ -82,7 +200,7 @@ func main() {
 	})
 
 	r.GET("/", func(c *gin.Context) {
-		log.Println("Go service root endpoint called")
+		slog.InfoContext(c.Request.Context(), "Go service root endpoint called")
 		c.JSON(http.StatusOK, gin.H{
 			"service": "go-gin-ebpf",
 			"status":  "running",
@@ -92,78 +210,46 @@ func main() {
 	r.POST("/pricing/calculate", func(c *gin.Context) {
 		var req PricingRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			log.Printf("Invalid request: %v", err)
+			slog.WarnContext(c.Request.Context(), fmt.Sprintf("Invalid request: %v", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		log.Printf("Calculating pricing for %s (quantity: %d)", req.ProductName, req.Quantity)
+		slog.InfoContext(c.Request.Context(), fmt.Sprintf("Calculating pricing for %s (quantity: %d)", req.ProductName, req.Quantity))
 
 		var unitPrice float64
 		err := db.QueryRowContext(c.Request.Context(), "SELECT unit_price FROM pricing WHERE product_name = ?", req.ProductName).Scan(&unitPrice)
 		if err != nil {
-			log.Printf("Database error: %v", err)
+			slog.ErrorContext(c.Request.Context(), fmt.Sprintf("Database error: %v", err))
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
 		}
 
 		totalPrice := unitPrice * float64(req.Quantity)
-		log.Printf("Pricing calculated: %.2f", totalPrice)
+		slog.InfoContext(c.Request.Context(), fmt.Sprintf("Pricing calculated: %.2f", totalPrice))
 
 		// Java serviceに通知を送信（Envoy egress検証用）
-		// 環境変数JAVA_SERVICE_URLで接続先を切り替え
-		// Envoy版: http://127.0.0.1:14318 (Envoy egress経由)
-		// それ以外: http://java-service:8081 (直接)
-		javaServiceURL := os.Getenv("JAVA_SERVICE_URL")
-		if javaServiceURL == "" {
-			javaServiceURL = "http://java-service:8081" // デフォルト
-		}
-
-		notificationData := map[string]interface{}{
-			"recipient": "pricing-service@example.com",
-			"message":   fmt.Sprintf("Price calculated: %s x %d = $%.2f", req.ProductName, req.Quantity, totalPrice),
-			"type":      "pricing_notification",
-		}
-
-		notificationJSON, err := json.Marshal(notificationData)
-		if err != nil {
-			log.Printf("Failed to marshal notification data: %v", err)
-		} else {
-			notificationEndpoint := javaServiceURL + "/notifications/send"
-			log.Printf("Sending notification to: %s", notificationEndpoint)
-
-			client := &http.Client{}
-			httpReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", notificationEndpoint, bytes.NewBuffer(notificationJSON))
-			if err != nil {
-				log.Printf("Failed to create notification request: %v", err)
-			} else {
-				httpReq.Header.Set("Content-Type", "application/json")
-
-				resp, err := client.Do(httpReq)
-				if err != nil {
-					log.Printf("Failed to send notification: %v", err)
-				} else {
-					defer resp.Body.Close()
-					body, _ := io.ReadAll(resp.Body)
-					log.Printf("Notification sent, response status: %d, body: %s", resp.StatusCode, string(body))
-				}
-			}
-		}
+		notified := notify(c.Request.Context(), notifier, notification.Notification{
+			Recipient: "pricing-service@example.com",
+			Message:   fmt.Sprintf("Price calculated: %s x %d = $%.2f", req.ProductName, req.Quantity, totalPrice),
+			Type:      "pricing_notification",
+		})
 
 		c.JSON(http.StatusOK, PricingResponse{
-			ProductName: req.ProductName,
-			UnitPrice:   unitPrice,
-			Quantity:    req.Quantity,
-			TotalPrice:  totalPrice,
+			ProductName:  req.ProductName,
+			UnitPrice:    unitPrice,
+			Quantity:     req.Quantity,
+			TotalPrice:   totalPrice,
+			Notification: &notified,
 		})
 	})
 
 	r.GET("/pricing", func(c *gin.Context) {
-		log.Println("Fetching all pricing")
+		slog.InfoContext(c.Request.Context(), "Fetching all pricing")
 
 		rows, err := db.QueryContext(c.Request.Context(), "SELECT * FROM pricing")
 		if err != nil {
-			log.Printf("Database error: %v", err)
+			slog.ErrorContext(c.Request.Context(), fmt.Sprintf("Database error: %v", err))
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -184,7 +270,7 @@ func main() {
 			})
 		}
 
-		log.Printf("Retrieved %d pricing items", len(pricing))
+		slog.InfoContext(c.Request.Context(), fmt.Sprintf("Retrieved %d pricing items", len(pricing)))
 
 		c.JSON(http.StatusOK, gin.H{
 			"pricing": pricing,
@@ -195,8 +281,10 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 	})
 
+	r.GET("/debug/propagation", gin.WrapH(propagation))
+
 	r.GET("/error", func(c *gin.Context) {
-		log.Println("Intentional error triggered")
+		slog.ErrorContext(c.Request.Context(), "Intentional error triggered")
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Intentional error for testing",
 		})
@@ -205,61 +293,30 @@ func main() {
 	r.POST("/pricing/calculate/error", func(c *gin.Context) {
 		var req PricingRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			log.Printf("Invalid request: %v", err)
+			slog.WarnContext(c.Request.Context(), fmt.Sprintf("Invalid request: %v", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		log.Printf("Intentional pricing error for %s", req.ProductName)
+		slog.ErrorContext(c.Request.Context(), fmt.Sprintf("Intentional pricing error for %s", req.ProductName))
 
 		var unitPrice float64
 		err := db.QueryRowContext(c.Request.Context(), "SELECT unit_price FROM pricing WHERE product_name = ?", req.ProductName).Scan(&unitPrice)
 		if err != nil {
-			log.Printf("Database error: %v", err)
+			slog.ErrorContext(c.Request.Context(), fmt.Sprintf("Database error: %v", err))
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
 		}
 
 		totalPrice := unitPrice * float64(req.Quantity)
-		log.Printf("Pricing calculation error (intentional): %.2f", totalPrice)
+		slog.ErrorContext(c.Request.Context(), fmt.Sprintf("Pricing calculation error (intentional): %.2f", totalPrice))
 
 		// Java serviceにエラー通知を送信（ヘッダー伝播なし - トレースが途切れることを示す）
-		javaServiceURL := os.Getenv("JAVA_SERVICE_URL")
-		if javaServiceURL == "" {
-			javaServiceURL = "http://java-service:8081" // デフォルト
-		}
-
-		notificationData := map[string]interface{}{
-			"recipient": "pricing-service@example.com",
-			"message":   fmt.Sprintf("Pricing error: %s x %d = $%.2f (ERROR)", req.ProductName, req.Quantity, totalPrice),
-			"type":      "pricing_error_notification",
-		}
-
-		notificationJSON, err := json.Marshal(notificationData)
-		if err != nil {
-			log.Printf("Failed to marshal notification data: %v", err)
-		} else {
-			notificationEndpoint := javaServiceURL + "/notifications/send"
-			log.Printf("Sending error notification to: %s", notificationEndpoint)
-
-			client := &http.Client{}
-			httpReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", notificationEndpoint, bytes.NewBuffer(notificationJSON))
-			if err != nil {
-				log.Printf("Failed to create notification request: %v", err)
-			} else {
-				httpReq.Header.Set("Content-Type", "application/json")
-				// NOTE: トレースヘッダーの伝播なし - Go → Javaでトレースが途切れる
-
-				resp, err := client.Do(httpReq)
-				if err != nil {
-					log.Printf("Failed to send notification: %v", err)
-				} else {
-					defer resp.Body.Close()
-					body, _ := io.ReadAll(resp.Body)
-					log.Printf("Error notification sent, response status: %d, body: %s", resp.StatusCode, string(body))
-				}
-			}
-		}
+		notified := notify(c.Request.Context(), notifier, notification.Notification{
+			Recipient: "pricing-service@example.com",
+			Message:   fmt.Sprintf("Pricing error: %s x %d = $%.2f (ERROR)", req.ProductName, req.Quantity, totalPrice),
+			Type:      "pricing_error_notification",
+		})
 
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":        "Intentional pricing calculation error",
@@ -268,6 +325,7 @@ func main() {
 			"quantity":     req.Quantity,
 			"total_price":  totalPrice,
 			"message":      "This is an intentional error for testing distributed tracing",
+			"notification": notified,
 		})
 	})
 
@@ -276,95 +334,42 @@ func main() {
 	r.POST("/pricing/calculate/notify", func(c *gin.Context) {
 		var req PricingRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			log.Printf("Invalid request: %v", err)
+			slog.WarnContext(c.Request.Context(), fmt.Sprintf("Invalid request: %v", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		log.Printf("Calculating pricing with notification for %s (quantity: %d)", req.ProductName, req.Quantity)
+		slog.InfoContext(c.Request.Context(), fmt.Sprintf("Calculating pricing with notification for %s (quantity: %d)", req.ProductName, req.Quantity))
 
 		// 価格計算
 		var unitPrice float64
 		err := db.QueryRowContext(c.Request.Context(), "SELECT unit_price FROM pricing WHERE product_name = ?", req.ProductName).Scan(&unitPrice)
 		if err != nil {
-			log.Printf("Database error: %v", err)
+			slog.ErrorContext(c.Request.Context(), fmt.Sprintf("Database error: %v", err))
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
 		}
 
 		totalPrice := unitPrice * float64(req.Quantity)
-		log.Printf("Pricing calculated: %.2f", totalPrice)
+		slog.InfoContext(c.Request.Context(), fmt.Sprintf("Pricing calculated: %.2f", totalPrice))
 
 		// Java serviceに通知を送信
-		// 環境変数JAVA_SERVICE_URLで接続先を切り替え
-		// Envoy版: http://127.0.0.1:14318 (Envoy egress経由)
-		// それ以外: http://java-service:8081 (直接)
-		javaServiceURL := os.Getenv("JAVA_SERVICE_URL")
-		if javaServiceURL == "" {
-			javaServiceURL = "http://java-service:8081" // デフォルト
-		}
-
-		notificationData := map[string]interface{}{
-			"recipient": "pricing-service@example.com",
-			"message":   fmt.Sprintf("Price calculated: %s x %d = $%.2f", req.ProductName, req.Quantity, totalPrice),
-			"type":      "pricing_notification",
-		}
-
-		notificationJSON, err := json.Marshal(notificationData)
-		if err != nil {
-			log.Printf("Failed to marshal notification data: %v", err)
-		} else {
-			notificationEndpoint := javaServiceURL + "/notifications/send"
-			log.Printf("Sending notification to: %s", notificationEndpoint)
-
-			client := &http.Client{}
-			httpReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", notificationEndpoint, bytes.NewBuffer(notificationJSON))
-			if err != nil {
-				log.Printf("Failed to create notification request: %v", err)
-			} else {
-				httpReq.Header.Set("Content-Type", "application/json")
-
-				resp, err := client.Do(httpReq)
-				if err != nil {
-					log.Printf("Failed to send notification: %v", err)
-				} else {
-					defer resp.Body.Close()
-					body, _ := io.ReadAll(resp.Body)
-					log.Printf("Notification sent, response status: %d, body: %s", resp.StatusCode, string(body))
-				}
-			}
-		}
+		notified := notify(c.Request.Context(), notifier, notification.Notification{
+			Recipient: "pricing-service@example.com",
+			Message:   fmt.Sprintf("Price calculated: %s x %d = $%.2f", req.ProductName, req.Quantity, totalPrice),
+			Type:      "pricing_notification",
+		})
 
 		c.JSON(http.StatusOK, gin.H{
 			"product_name":      req.ProductName,
 			"unit_price":        unitPrice,
 			"quantity":          req.Quantity,
 			"total_price":       totalPrice,
-			"notification_sent": true,
+			"notification_sent": notified.Status == notification.StatusSent,
+			"notification":      notified,
 			"java_service_url":  javaServiceURL,
 		})
 	})
 
-	// Start server
-	srv := &http.Server{
-		Addr:    ":8080",
-		Handler: r,
-	}
-
-	go func() {
-		log.Println("Go service listening on port 8080")
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
-		}
-	}()
-
-	// Graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-
-	log.Println("Shutting down server...")
-	if err := srv.Shutdown(nil); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
-	}
+	return r, nil
 }
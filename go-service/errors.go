@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errorFlagKey is set on every failed server span. The collector's
+// tail_sampling/go policy matches on it so that traces containing an error
+// are always kept; failed DB spans are kept by their ERROR status, which
+// otelsql sets.
+const errorFlagKey = attribute.Key("error.flagged")
+
+// recordError marks span as failed: exception event with stack trace, error
+// status and the tail sampling flag.
+func recordError(span trace.Span, err error) {
+	span.RecordError(err, trace.WithStackTrace(true))
+	span.SetStatus(codes.Error, err.Error())
+	flagError(span, errorType(err))
+}
+
+func flagError(span trace.Span, errType string) {
+	span.SetAttributes(errorFlagKey.Bool(true), semconv.ErrorTypeKey.String(errType))
+}
+
+// errorType returns a low-cardinality error.type value for err.
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "sql.ErrNoRows"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "context.DeadlineExceeded"
+	case errors.Is(err, context.Canceled):
+		return "context.Canceled"
+	default:
+		return fmt.Sprintf("%T", err)
+	}
+}
+
+// errorMiddleware flags the server span of failed requests. It has to be
+// registered after otelgin so the span is still open when a panic unwinds
+// through here; the panic is re-raised for gin.Recovery to answer with 500.
+func errorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		span := trace.SpanFromContext(c.Request.Context())
+
+		defer func() {
+			if r := recover(); r != nil {
+				err, ok := r.(error)
+				if !ok {
+					err = fmt.Errorf("panic: %v", r)
+				}
+				span.RecordError(err, trace.WithStackTrace(true))
+				span.SetStatus(codes.Error, err.Error())
+				span.SetAttributes(semconv.HTTPResponseStatusCode(http.StatusInternalServerError))
+				flagError(span, "panic")
+				panic(r)
+			}
+		}()
+
+		c.Next()
+
+		// otelgin sets the status for 5xx and records c.Errors as exception
+		// events; add the flag on top. 4xx stays unset here as the HTTP
+		// semantic conventions require; the one exception is the 404 for
+		// an unknown product, which the handlers flag themselves with
+		// recordError because the sql.ErrNoRows behind it points at missing
+		// pricing data rather than a bad request.
+		status := c.Writer.Status()
+		if status >= http.StatusInternalServerError {
+			if len(c.Errors) == 0 {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			flagError(span, strconv.Itoa(status))
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
+
+	"github.com/nutslove/otel-instrumentation-demo/go-common/tracelog"
+)
+
+// newLogger returns the service logger. Every record is emitted through the
+// OTel bridge (OTLP to Loki, trace context on the record itself) and written
+// as JSON to stdout for the Loki docker driver, with trace_id and span_id
+// added as fields so both paths carry the same structured data.
+func newLogger() *slog.Logger {
+	return slog.New(tracelog.NewMultiHandler(
+		otelslog.NewHandler("go-service-logger"),
+		tracelog.NewHandler(slog.NewJSONHandler(os.Stdout, nil)),
+	))
+}
@@ -3,38 +3,42 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/XSAM/otelsql"
 	"github.com/gin-gonic/gin"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 
 	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
-	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
-	otlog "go.opentelemetry.io/otel/log"
-	"go.opentelemetry.io/otel/log/global"
-	"go.opentelemetry.io/otel/propagation"
-	sdklog "go.opentelemetry.io/otel/sdk/log"
-	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
 	"go.opentelemetry.io/otel/trace"
+
+	"github.com/nutslove/otel-instrumentation-demo/go-common/propcheck"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/sqlcomment"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/telemetry"
 )
 
+// serverName is the service's name in otelgin's server.address attribute.
+const serverName = "go-gin-service"
+
+// defaultAdminAddr is where the admin endpoints listen without ADMIN_ADDR.
+const defaultAdminAddr = "localhost:6060"
+
 var (
-	db     *sql.DB
-	tracer trace.Tracer
-	logger otlog.Logger
+	db      *sql.DB
+	logger  *slog.Logger
+	sampler *telemetry.ReloadableSampler
+	tracez  http.Handler
 )
 
 type PricingRequest struct {
@@ -49,111 +53,70 @@ type PricingResponse struct {
 	TotalPrice  float64 `json:"total_price"`
 }
 
-func initTelemetry(ctx context.Context) (func(), error) {
-	// Resource
-	res, err := resource.New(ctx,
-		resource.WithContainer(), // Add container information
-		resource.WithProcess(),   // Add process information
-		resource.WithAttributes(
-			semconv.ServiceName("go-gin-service"),
-			semconv.ServiceVersion("1.0.0"),
-		),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create resource: %w", err)
-	}
-
-	// Trace exporter
-	traceExporter, err := otlptracehttp.New(ctx,
-		otlptracehttp.WithEndpoint("otel-collector:4318"),
-		otlptracehttp.WithInsecure(),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
-	}
-
-	// Trace provider
-	tracerProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(
-			traceExporter,
-			sdktrace.WithBatchTimeout(time.Second), // デフォルトは5秒
-		),
-		sdktrace.WithResource(res),
-	)
-	otel.SetTracerProvider(tracerProvider)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-	tracer = tracerProvider.Tracer("go-service-tracer")
-
-	// Metrics exporter
-	metricExporter, err := otlpmetrichttp.New(ctx,
-		otlpmetrichttp.WithEndpoint("otel-collector:4318"),
-		otlpmetrichttp.WithInsecure(),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create metric exporter: %w", err)
-	}
+type SamplerRequest struct {
+	Sampler string `json:"sampler" binding:"required"`
+	Arg     string `json:"arg"`
+}
 
-	// Meter provider
-	meterProvider := sdkmetric.NewMeterProvider(
-		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
-		sdkmetric.WithResource(res),
-	)
-	otel.SetMeterProvider(meterProvider)
-
-	// Log exporter
-	logExporter, err := otlploghttp.New(ctx,
-		otlploghttp.WithEndpoint("otel-collector:4318"),
-		otlploghttp.WithInsecure(),
-	)
+func initTelemetry(ctx context.Context) (func(), error) {
+	// Defaults below are overridden by the standard OTEL_* environment variables
+	tel, err := telemetry.New(ctx, telemetry.Config{
+		ServiceName:    "go-gin-service",
+		ServiceVersion: "1.0.0",
+		Endpoint:       "otel-collector:4318",
+		GRPCEndpoint:   "otel-collector:4317",
+		BatchTimeout:   time.Second, // デフォルトは5秒
+		Traces:         true,
+		Metrics:        true,
+		Logs:           true,
+		RuntimeMetrics: true,
+		HostMetrics:    true,
+		Tracez:         true,
+		// Buffers exports on disk while the collector is unavailable
+		QueueDir: os.Getenv("EXPORT_QUEUE_DIR"),
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create log exporter: %w", err)
+		return nil, err
 	}
-
-	// Logger provider
-	loggerProvider := sdklog.NewLoggerProvider(
-		sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)),
-		sdklog.WithResource(res),
-	)
-	global.SetLoggerProvider(loggerProvider)
-	logger = loggerProvider.Logger("go-service-logger")
+	logger = newLogger()
+	slog.SetDefault(logger)
+	sampler = tel.Sampler
+	tracez = tel.TracezHandler
 
 	// Cleanup function
 	cleanup := func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
-		tracerProvider.Shutdown(ctx)
-		meterProvider.Shutdown(ctx)
-		loggerProvider.Shutdown(ctx)
+		tel.Shutdown(ctx)
 	}
 
 	return cleanup, nil
 }
 
-func emitLog(ctx context.Context, severity otlog.Severity, message string, attrs ...attribute.KeyValue) {
-	span := trace.SpanFromContext(ctx)
-	spanCtx := span.SpanContext()
+func initDB(path string) error {
+	var err error
 
-	// Convert attribute.KeyValue to otlog.KeyValue
-	logAttrs := make([]otlog.KeyValue, len(attrs)+2)
-	for i, attr := range attrs {
-		logAttrs[i] = otlog.String(string(attr.Key), attr.Value.AsString())
+	// Optional query log with every statement as sent and its duration
+	var queryLog *sqlcomment.QueryLog
+	if path := os.Getenv("SQL_QUERY_LOG"); path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		queryLog = sqlcomment.NewQueryLog(f)
 	}
-	logAttrs[len(attrs)] = otlog.String("trace_id", spanCtx.TraceID().String())
-	logAttrs[len(attrs)+1] = otlog.String("span_id", spanCtx.SpanID().String())
-
-	var record otlog.Record
-	record.SetTimestamp(time.Now())
-	record.SetSeverity(severity)
-	record.SetBody(otlog.StringValue(message))
-	record.AddAttributes(logAttrs...)
-
-	logger.Emit(ctx, record)
-}
 
-func initDB() error {
-	var err error
-	db, err = sql.Open("sqlite3", "/data/pricing.db")
-	if err != nil {
+	// Every statement becomes a span and a db.client.operation.duration
+	// measurement; the pool is reported from db.Stats(). The sqlcomment
+	// connector underneath gets the DB span's context, so statements carry
+	// a sqlcommenter comment with its traceparent and the route
+	dbOptions := []otelsql.Option{
+		otelsql.WithAttributes(semconv.DBSystemNameSQLite),
+		otelsql.WithSpanNameFormatter(dbSpanName),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{DisableErrSkip: true, OmitConnResetSession: true}),
+	}
+	db = otelsql.OpenDB(sqlcomment.NewConnector(&sqlite3.SQLiteDriver{}, path, queryLog), dbOptions...)
+	if _, err := otelsql.RegisterDBStatsMetrics(db, dbOptions...); err != nil {
 		return err
 	}
 
@@ -177,6 +140,15 @@ func initDB() error {
 	return err
 }
 
+// dbSpanName names the spans of statements after their operation, e.g.
+// "SELECT", and the others after otelsql's method, e.g. "sql.tx.commit".
+func dbSpanName(_ context.Context, method otelsql.Method, query string) string {
+	if operation, _, _ := strings.Cut(strings.TrimSpace(query), " "); operation != "" {
+		return strings.ToUpper(operation)
+	}
+	return string(method)
+}
+
 func main() {
 	ctx := context.Background()
 
@@ -187,17 +159,92 @@ func main() {
 	}
 	defer cleanup()
 
+	stopProfiling, err := initProfiling()
+	if err != nil {
+		log.Fatalf("Failed to initialize profiling: %v", err)
+	}
+	defer stopProfiling()
+
+	if err := initMetrics(); err != nil {
+		log.Fatalf("Failed to initialize metrics: %v", err)
+	}
+
 	// Initialize database
-	if err := initDB(); err != nil {
+	if err := initDB("/data/pricing.db"); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
 
+	// Counts the requests whose trace is lost on the way to the Java service
+	propagation, err := propcheck.New(propcheck.Config{Exclude: []string{"/health", "/debug/"}})
+	if err != nil {
+		log.Fatalf("Failed to initialize propagation check: %v", err)
+	}
+
+	r := newRouter()
+
+	// Start server
+	srv := &http.Server{
+		Addr:    ":8080",
+		Handler: propagation.Handler(r),
+	}
+
+	go func() {
+		log.Println("Go service listening on port 8080")
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// Admin endpoints change the running service, so they get a listener of
+	// their own instead of the public port: ADMIN_ADDR, loopback only by
+	// default
+	adminAddr := os.Getenv("ADMIN_ADDR")
+	if adminAddr == "" {
+		adminAddr = defaultAdminAddr
+	}
+	adminSrv := &http.Server{
+		Addr:    adminAddr,
+		Handler: newAdminRouter(propagation),
+	}
+
+	go func() {
+		log.Printf("Admin endpoints listening on %s", adminAddr)
+		if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start admin server: %v", err)
+		}
+	}()
+
+	// Graceful shutdown
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	adminSrv.Shutdown(ctx)
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Fatalf("Server forced to shutdown: %v", err)
+	}
+}
+
+// newRouter returns the service's routes and middleware. The propagation
+// check's Handler goes around it.
+func newRouter() *gin.Engine {
 	// Setup Gin
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(gin.Recovery())
-	r.Use(otelgin.Middleware("go-gin-service"))
+	r.Use(otelgin.Middleware(serverName, otelgin.WithGinMetricAttributeFn(httpMetricAttributes)))
+	r.Use(errorMiddleware())
+	r.Use(activeRequestsMiddleware())
+	r.Use(profilingMiddleware())
+
+	// Route for the sqlcommenter comments of the request's statements
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(sqlcomment.ContextWithRoute(c.Request.Context(), c.FullPath()))
+		c.Next()
+	})
 
 	// CORS
 	r.Use(func(c *gin.Context) {
@@ -213,10 +260,8 @@ func main() {
 
 	r.GET("/", func(c *gin.Context) {
 		ctx := c.Request.Context()
-		span := trace.SpanFromContext(ctx)
-		traceID := span.SpanContext().TraceID().String()
 
-		emitLog(ctx, otlog.SeverityInfo, fmt.Sprintf("Go service root endpoint called - trace_id: %s", traceID))
+		logger.InfoContext(ctx, "Go service root endpoint called")
 
 		c.JSON(http.StatusOK, gin.H{
 			"service": "go-gin",
@@ -226,49 +271,54 @@ func main() {
 
 	r.POST("/pricing/calculate", func(c *gin.Context) {
 		ctx := c.Request.Context()
-		span := trace.SpanFromContext(ctx)
-		traceID := span.SpanContext().TraceID().String()
 
 		var req PricingRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			emitLog(ctx, otlog.SeverityError, fmt.Sprintf("Invalid request: %v - trace_id: %s", err, traceID))
+			logger.ErrorContext(ctx, fmt.Sprintf("Invalid request: %v", err), slog.Any("error", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		emitLog(ctx, otlog.SeverityInfo, fmt.Sprintf("Calculating pricing for %s - trace_id: %s", req.ProductName, traceID),
-			attribute.String("product.name", req.ProductName),
-			attribute.Int("quantity", req.Quantity),
+		logger.InfoContext(ctx, fmt.Sprintf("Calculating pricing for %s", req.ProductName),
+			slog.String("product.name", req.ProductName),
+			slog.Int("quantity", req.Quantity),
 		)
 
-		// Database query with span
-		sql := "SELECT unit_price FROM pricing WHERE product_name = ?"
-		dbCtx, dbSpan := tracer.Start(ctx, "db_select_pricing",
-			trace.WithAttributes(
-				attribute.String("db.operation.name", "select"),
-				attribute.String("db.collection.name", "pricing"),
-				attribute.String("db.query.text", sql),
-				attribute.String("product.name", req.ProductName),
-			),
-		)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("product.name", req.ProductName))
 
+		// otelsql creates the "SELECT pricing" span, scan included
 		var unitPrice float64
-		err := db.QueryRowContext(dbCtx, sql, req.ProductName).Scan(&unitPrice)
-		dbSpan.End()
+		err := db.QueryRowContext(ctx, "SELECT unit_price FROM pricing WHERE product_name = ?", req.ProductName).Scan(&unitPrice)
 
-		if err != nil {
-			emitLog(ctx, otlog.SeverityError, fmt.Sprintf("Database error: %v - trace_id: %s", err, traceID))
+		if errors.Is(err, sql.ErrNoRows) {
+			// database/sql reports no rows after the DB span has ended, so
+			// the request's span records it
+			recordError(trace.SpanFromContext(ctx), err)
+			logger.ErrorContext(ctx, fmt.Sprintf("Product not found: %s", req.ProductName), slog.String("product.name", req.ProductName))
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
 		}
+		if err != nil {
+			logger.ErrorContext(ctx, fmt.Sprintf("Database error: %v", err), slog.Any("error", err))
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
 		totalPrice := unitPrice * float64(req.Quantity)
+		recordPricing(ctx, req.ProductName, totalPrice)
 
-		emitLog(ctx, otlog.SeverityInfo, fmt.Sprintf("Pricing calculated: %.2f - trace_id: %s", totalPrice, traceID),
-			attribute.Float64("unit.price", unitPrice),
-			attribute.Float64("total.price", totalPrice),
+		logger.InfoContext(ctx, fmt.Sprintf("Pricing calculated: %.2f", totalPrice),
+			slog.Float64("unit.price", unitPrice),
+			slog.Float64("total.price", totalPrice),
 		)
 
+		notify(ctx, Notification{
+			Recipient: "pricing-service@example.com",
+			Message:   fmt.Sprintf("Price calculated: %s x %d = $%.2f", req.ProductName, req.Quantity, totalPrice),
+			Type:      "pricing_notification",
+		})
+
 		c.JSON(http.StatusOK, PricingResponse{
 			ProductName: req.ProductName,
 			UnitPrice:   unitPrice,
@@ -279,23 +329,15 @@ func main() {
 
 	r.GET("/pricing", func(c *gin.Context) {
 		ctx := c.Request.Context()
-		span := trace.SpanFromContext(ctx)
-		traceID := span.SpanContext().TraceID().String()
 
-		emitLog(ctx, otlog.SeverityInfo, fmt.Sprintf("Fetching all pricing - trace_id: %s", traceID))
-
-		dbCtx, dbSpan := tracer.Start(ctx, "db_select_all_pricing",
-			trace.WithAttributes(
-				attribute.String("db.operation", "select"),
-				attribute.String("db.table", "pricing"),
-			),
-		)
-
-		rows, err := db.QueryContext(dbCtx, "SELECT * FROM pricing")
-		dbSpan.End()
+		logger.InfoContext(ctx, "Fetching all pricing")
 
+		// The otelsql span ends when the rows are closed, i.e. after the last
+		// row has been scanned
+		rows, err := db.QueryContext(ctx, "SELECT * FROM pricing")
 		if err != nil {
-			emitLog(ctx, otlog.SeverityError, fmt.Sprintf("Database error: %v - trace_id: %s", err, traceID))
+			logger.ErrorContext(ctx, fmt.Sprintf("Database error: %v", err), slog.Any("error", err))
+			c.Error(err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
@@ -316,7 +358,7 @@ func main() {
 			})
 		}
 
-		emitLog(ctx, otlog.SeverityInfo, fmt.Sprintf("Retrieved %d pricing items - trace_id: %s", len(pricing), traceID))
+		logger.InfoContext(ctx, fmt.Sprintf("Retrieved %d pricing items", len(pricing)), slog.Int("pricing.count", len(pricing)))
 
 		c.JSON(http.StatusOK, gin.H{
 			"pricing": pricing,
@@ -329,11 +371,10 @@ func main() {
 
 	r.GET("/error", func(c *gin.Context) {
 		ctx := c.Request.Context()
-		span := trace.SpanFromContext(ctx)
-		traceID := span.SpanContext().TraceID().String()
 
-		emitLog(ctx, otlog.SeverityError, fmt.Sprintf("Intentional error triggered - trace_id: %s", traceID))
+		logger.ErrorContext(ctx, "Intentional error triggered")
 
+		c.Error(errors.New("intentional error for testing"))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Intentional error for testing",
 		})
@@ -341,46 +382,52 @@ func main() {
 
 	r.POST("/pricing/calculate/error", func(c *gin.Context) {
 		ctx := c.Request.Context()
-		span := trace.SpanFromContext(ctx)
-		traceID := span.SpanContext().TraceID().String()
 
 		var req PricingRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			emitLog(ctx, otlog.SeverityError, fmt.Sprintf("Invalid request: %v - trace_id: %s", err, traceID))
+			logger.ErrorContext(ctx, fmt.Sprintf("Invalid request: %v", err), slog.Any("error", err))
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		emitLog(ctx, otlog.SeverityError, fmt.Sprintf("Intentional pricing error for %s - trace_id: %s", req.ProductName, traceID),
-			attribute.String("product.name", req.ProductName),
-			attribute.Int("quantity", req.Quantity),
+		logger.ErrorContext(ctx, fmt.Sprintf("Intentional pricing error for %s", req.ProductName),
+			slog.String("product.name", req.ProductName),
+			slog.Int("quantity", req.Quantity),
 		)
 
 		// Simulate pricing calculation but return error
-		sql := "SELECT unit_price FROM pricing WHERE product_name = ?"
-		dbCtx, dbSpan := tracer.Start(ctx, "db_select_pricing_error",
-			trace.WithAttributes(
-				attribute.String("db.operation.name", "select"),
-				attribute.String("db.collection.name", "pricing"),
-				attribute.String("db.query.text", sql),
-				attribute.String("product.name", req.ProductName),
-			),
-		)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("product.name", req.ProductName))
 
+		// otelsql creates the "SELECT pricing" span, scan included
 		var unitPrice float64
-		err := db.QueryRowContext(dbCtx, sql, req.ProductName).Scan(&unitPrice)
-		dbSpan.End()
+		err := db.QueryRowContext(ctx, "SELECT unit_price FROM pricing WHERE product_name = ?", req.ProductName).Scan(&unitPrice)
 
-		if err != nil {
-			emitLog(ctx, otlog.SeverityError, fmt.Sprintf("Database error: %v - trace_id: %s", err, traceID))
+		if errors.Is(err, sql.ErrNoRows) {
+			// database/sql reports no rows after the DB span has ended, so
+			// the request's span records it
+			recordError(trace.SpanFromContext(ctx), err)
+			logger.ErrorContext(ctx, fmt.Sprintf("Product not found: %s", req.ProductName), slog.String("product.name", req.ProductName))
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
 		}
+		if err != nil {
+			logger.ErrorContext(ctx, fmt.Sprintf("Database error: %v", err), slog.Any("error", err))
+			c.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 
 		totalPrice := unitPrice * float64(req.Quantity)
 
-		emitLog(ctx, otlog.SeverityError, fmt.Sprintf("Pricing calculation error (intentional): %.2f - trace_id: %s", totalPrice, traceID))
+		logger.ErrorContext(ctx, fmt.Sprintf("Pricing calculation error (intentional): %.2f", totalPrice), slog.Float64("total.price", totalPrice))
+
+		notify(ctx, Notification{
+			Recipient: "pricing-service@example.com",
+			Message:   fmt.Sprintf("Pricing error: %s x %d = $%.2f (ERROR)", req.ProductName, req.Quantity, totalPrice),
+			Type:      "pricing_error_notification",
+		})
 
+		c.Error(errors.New("intentional pricing calculation error"))
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":        "Intentional pricing calculation error",
 			"product_name": req.ProductName,
@@ -391,27 +438,64 @@ func main() {
 		})
 	})
 
-	// Start server
-	srv := &http.Server{
-		Addr:    ":8080",
-		Handler: r,
-	}
+	return r
+}
 
-	go func() {
-		log.Println("Go service listening on port 8080")
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+// newAdminRouter returns the admin routes, served on ADMIN_ADDR. The debug
+// pages show span names, attributes and request counts, so they are kept off
+// the public port along with the sampler admin.
+func newAdminRouter(propagation *propcheck.Checker) *gin.Engine {
+	r := gin.New()
+	r.Use(gin.Recovery())
+
+	// Head sampler admin: GET shows the active sampler, PUT swaps it at runtime
+	// e.g. {"sampler": "parentbased_traceidratio", "arg": "0.1"}
+	r.GET("/admin/sampler", func(c *gin.Context) {
+		name, arg := sampler.Config()
+		c.JSON(http.StatusOK, gin.H{
+			"sampler":     name,
+			"arg":         arg,
+			"description": sampler.Description(),
+		})
+	})
+
+	r.PUT("/admin/sampler", func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		var req SamplerRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-	}()
 
-	// Graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+		if err := sampler.Update(req.Sampler, req.Arg); err != nil {
+			logger.WarnContext(ctx, fmt.Sprintf("Rejected sampler update: %v", err), slog.Any("error", err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		logger.InfoContext(ctx, fmt.Sprintf("Sampler updated to %s", sampler.Description()),
+			slog.String("sampler.name", req.Sampler),
+			slog.String("sampler.arg", req.Arg),
+		)
+
+		c.JSON(http.StatusOK, gin.H{
+			"sampler":     req.Sampler,
+			"arg":         req.Arg,
+			"description": sampler.Description(),
+		})
+	})
+
+	// In-flight and recent spans straight from the process, for when they do
+	// not show up in Tempo (absent when trace export is switched off)
+	if tracez != nil {
+		r.GET("/debug/tracez", gin.WrapH(tracez))
 	}
+
+	r.GET("/debug/propagation", gin.WrapH(propagation))
+
+	// On-demand profiles, e.g. go tool pprof http://localhost:6060/debug/pprof/heap
+	registerPprof(r)
+
+	return r
 }
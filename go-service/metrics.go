@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+
+	"github.com/nutslove/otel-instrumentation-demo/go-common/semconvcompat"
+)
+
+// HTTP rate, errors and duration come from otelgin's semconv histogram
+// http.server.request.duration, broken down by http.route and
+// http.response.status_code (plus error.type from httpMetricAttributes).
+// The instruments below cover what otelgin does not record.
+//
+// Histograms recorded with a context carrying a sampled span get that span's
+// trace and span IDs as exemplars (OTEL_METRICS_EXEMPLAR_FILTER=trace_based,
+// the SDK default), so always pass the request span context. DB metrics come
+// from otelsql.
+var (
+	activeRequests      metric.Int64UpDownCounter
+	pricingCalculations metric.Int64Counter
+	pricingTotalPrice   metric.Float64Histogram
+)
+
+func initMetrics() error {
+	meter := otel.Meter("go-service-meter")
+
+	var err error
+	activeRequests, err = meter.Int64UpDownCounter("http.server.active_requests",
+		metric.WithDescription("Number of active HTTP server requests."),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	pricingCalculations, err = meter.Int64Counter("pricing.calculations",
+		metric.WithDescription("Number of successful pricing calculations."),
+		metric.WithUnit("{calculation}"),
+	)
+	if err != nil {
+		return err
+	}
+
+	pricingTotalPrice, err = meter.Float64Histogram("pricing.total_price",
+		metric.WithDescription("Total price of successful pricing calculations."),
+		metric.WithExplicitBucketBoundaries(10, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 50000),
+	)
+	return err
+}
+
+// activeRequestsMiddleware maintains http.server.active_requests. Its
+// attributes are limited to the ones known before the request is routed.
+func activeRequestsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		attrs := metric.WithAttributes(semconvcompat.HTTP().Attributes(semconvcompat.HTTPServerKeys,
+			semconv.HTTPRequestMethodKey.String(c.Request.Method),
+			semconv.URLScheme("http"),
+		)...)
+		ctx := c.Request.Context()
+		activeRequests.Add(ctx, 1, attrs)
+		defer activeRequests.Add(ctx, -1, attrs)
+		c.Next()
+	}
+}
+
+// httpMetricAttributes adds error.type to otelgin's request metrics for 5xx
+// responses, as the HTTP semantic conventions require. With
+// OTEL_SEMCONV_STABILITY_OPT_IN=http/dup or http/old it also adds the old
+// names of the attributes otelgin records (http.method, http.status_code,
+// ...), which otelgin itself no longer writes.
+func httpMetricAttributes(c *gin.Context) []attribute.KeyValue {
+	status := c.Writer.Status()
+	var attrs []attribute.KeyValue
+	if status >= 500 {
+		attrs = append(attrs, semconv.ErrorTypeKey.String(strconv.Itoa(status)))
+	}
+	return append(attrs, semconvcompat.HTTP().Legacy(semconvcompat.HTTPServerKeys,
+		semconv.HTTPRequestMethodKey.String(c.Request.Method),
+		semconv.URLScheme("http"),
+		semconv.ServerAddress(serverName),
+		semconv.NetworkProtocolVersion(fmt.Sprintf("%d.%d", c.Request.ProtoMajor, c.Request.ProtoMinor)),
+		semconv.HTTPResponseStatusCode(status),
+	)...)
+}
+
+// recordPricing records a successful calculation for product.
+func recordPricing(ctx context.Context, product string, totalPrice float64) {
+	attrs := metric.WithAttributes(attribute.String("product.name", product))
+	pricingCalculations.Add(ctx, 1, attrs)
+	pricingTotalPrice.Record(ctx, totalPrice, attrs)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+
+	"github.com/nutslove/otel-instrumentation-demo/go-common/propcheck"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/semconvcompat"
+)
+
+// notificationClient calls the Java notification service. otelhttp makes
+// every call a CLIENT span (server.address, http.response.status_code, Error
+// status for failed calls and 4xx/5xx responses) and injects its context
+// with the global propagator, so the Java spans join the same trace;
+// propcheck.Transport checks the injected headers.
+var notificationClient = &http.Client{
+	Transport: otelhttp.NewTransport(&propcheck.Transport{},
+		otelhttp.WithMetricAttributesFn(notificationMetricAttributes)),
+	Timeout: 5 * time.Second,
+}
+
+// notificationMetricAttributes adds the old names of otelhttp's client
+// metric attributes (http.method, net.peer.name, net.peer.port) in http/dup
+// and http/old mode. The hook only sees the request, so http.status_code
+// has no old counterpart on these metrics.
+func notificationMetricAttributes(r *http.Request) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(r.Method),
+		semconv.ServerAddress(r.URL.Hostname()),
+	}
+	if port, err := strconv.Atoi(r.URL.Port()); err == nil {
+		attrs = append(attrs, semconv.ServerPort(port))
+	}
+	return semconvcompat.HTTP().Legacy(semconvcompat.HTTPClientKeys, attrs...)
+}
+
+type Notification struct {
+	Recipient string `json:"recipient"`
+	Message   string `json:"message"`
+	Type      string `json:"type"`
+}
+
+// notificationURL is the Java service's send endpoint; JAVA_SERVICE_URL
+// overrides the compose default.
+func notificationURL() string {
+	javaServiceURL := os.Getenv("JAVA_SERVICE_URL")
+	if javaServiceURL == "" {
+		javaServiceURL = "http://java-service:8081"
+	}
+	return javaServiceURL + "/notifications/send"
+}
+
+// sendNotification posts n to the Java service as a child of the span in ctx
+// and returns the response body.
+func sendNotification(ctx context.Context, n Notification) (string, error) {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, notificationURL(), bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := notificationClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	// Reading to EOF and closing ends the CLIENT span.
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("notification service returned %s", resp.Status)
+	}
+	return string(body), nil
+}
+
+// notify sends n and logs the outcome. A failed notification does not fail
+// the pricing request; the CLIENT span and the log carry the error instead.
+func notify(ctx context.Context, n Notification) {
+	logger.InfoContext(ctx, fmt.Sprintf("Sending notification to: %s", notificationURL()), slog.String("notification.type", n.Type))
+
+	body, err := sendNotification(ctx, n)
+	if err != nil {
+		logger.ErrorContext(ctx, fmt.Sprintf("Failed to send notification: %v", err), slog.Any("error", err))
+		return
+	}
+	logger.InfoContext(ctx, fmt.Sprintf("Notification sent, response: %s", body), slog.String("notification.type", n.Type))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http/pprof"
+	"os"
+	rpprof "runtime/pprof"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/grafana/pyroscope-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// profileIDKey is the span attribute Grafana's trace-to-profile link looks
+// for; its value is the span_id label on the profile samples.
+const profileIDKey = attribute.Key("pyroscope.profile.id")
+
+// initProfiling pushes CPU and heap profiles to the Pyroscope server at
+// PYROSCOPE_SERVER_ADDRESS, if set, and returns a function stopping it.
+// The profiles are named after OTEL_SERVICE_NAME like the other signals.
+func initProfiling() (func(), error) {
+	addr := os.Getenv("PYROSCOPE_SERVER_ADDRESS")
+	if addr == "" {
+		return func() {}, nil
+	}
+	name := os.Getenv("OTEL_SERVICE_NAME")
+	if name == "" {
+		name = serverName
+	}
+
+	profiler, err := pyroscope.Start(pyroscope.Config{
+		ApplicationName: name,
+		ServerAddress:   addr,
+		ProfileTypes: []pyroscope.ProfileType{
+			pyroscope.ProfileCPU,
+			pyroscope.ProfileAllocObjects,
+			pyroscope.ProfileAllocSpace,
+			pyroscope.ProfileInuseObjects,
+			pyroscope.ProfileInuseSpace,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Pushing profiles to %s", addr)
+	return func() { profiler.Stop() }, nil
+}
+
+// profilingMiddleware runs the rest of the chain under pprof labels with
+// the otelgin span's ID and name, so the CPU samples taken while serving a
+// request can be selected by span (heap profiles carry no labels). The
+// span gets the matching pyroscope.profile.id attribute. It must come after
+// otelgin.Middleware.
+func profilingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		span := trace.SpanFromContext(c.Request.Context())
+		sc := span.SpanContext()
+		if !sc.IsSampled() {
+			c.Next()
+			return
+		}
+
+		spanID := sc.SpanID().String()
+		span.SetAttributes(profileIDKey.String(spanID))
+		labels := rpprof.Labels("span_id", spanID, "span_name", c.Request.Method+" "+c.FullPath())
+		rpprof.Do(c.Request.Context(), labels, func(ctx context.Context) {
+			c.Request = c.Request.WithContext(ctx)
+			c.Next()
+		})
+	}
+}
+
+// registerPprof serves the net/http/pprof endpoints under /debug/pprof/.
+func registerPprof(r *gin.Engine) {
+	r.GET("/debug/pprof/*profile", func(c *gin.Context) {
+		switch strings.TrimPrefix(c.Param("profile"), "/") {
+		case "cmdline":
+			pprof.Cmdline(c.Writer, c.Request)
+		case "profile":
+			pprof.Profile(c.Writer, c.Request)
+		case "symbol":
+			pprof.Symbol(c.Writer, c.Request)
+		case "trace":
+			pprof.Trace(c.Writer, c.Request)
+		default:
+			// The index, and heap, goroutine, allocs, ... by name
+			pprof.Index(c.Writer, c.Request)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/nutslove/otel-instrumentation-demo/go-common/propcheck"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/propcheck/propchecktest"
+	"github.com/nutslove/otel-instrumentation-demo/go-common/telemetry"
+)
+
+// testRouter returns the service's handler on a fresh database, with the
+// propagators of docker-compose.yml and spans kept in memory.
+func testRouter(t *testing.T) http.Handler {
+	t.Helper()
+	t.Setenv("OTEL_PROPAGATORS", "b3,b3multi,jaeger,xray,tracecontext,baggage")
+	if _, err := telemetry.New(context.Background(), telemetry.Config{ServiceName: serverName}); err != nil {
+		t.Fatal(err)
+	}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	logger = slog.Default()
+	if err := initMetrics(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := initDB(filepath.Join(t.TempDir(), "pricing.db")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	propagation, err := propcheck.New(propcheck.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return propagation.Handler(newRouter())
+}
+
+func TestHeaderPropagation(t *testing.T) {
+	const traceID = propchecktest.UpstreamTraceID
+
+	// The CLIENT span continues the upstream trace (tracecontext is
+	// extracted last, so it wins) and every propagator injects its own
+	// headers for it; x-request-id is not trace context and stays behind.
+	// The span ID is the CLIENT span's, taken from traceparent.
+	want := func(spanID string) map[string]string {
+		return map[string]string{
+			"traceparent":     "00-" + traceID + "-" + spanID + "-01",
+			"b3":              traceID + "-" + spanID + "-1",
+			"x-b3-traceid":    traceID,
+			"x-b3-spanid":     spanID,
+			"x-b3-sampled":    "1",
+			"uber-trace-id":   traceID + ":" + spanID + ":0:1",
+			"x-amzn-trace-id": "Root=1-" + traceID[:8] + "-" + traceID[8:] + ";Parent=" + spanID + ";Sampled=1",
+		}
+	}
+
+	propchecktest.Run(t, testRouter, []propchecktest.Case{
+		{Path: "/pricing/calculate", Status: http.StatusOK},
+		{Path: "/pricing/calculate/error", Status: http.StatusInternalServerError},
+		// No /pricing/calculate/notify: /pricing/calculate notifies already
+	}, func(t *testing.T, got map[string]string) {
+		parts := strings.Split(got["traceparent"], "-")
+		if len(parts) != 4 {
+			t.Fatalf("traceparent = %q, want version-traceid-spanid-flags", got["traceparent"])
+		}
+		if parts[2] == propchecktest.UpstreamSpanID {
+			t.Errorf("traceparent %q carries the caller's span, want the CLIENT span", got["traceparent"])
+		}
+		if want := want(parts[2]); !maps.Equal(got, want) {
+			t.Errorf("headers reaching the Java service = %v, want %v", got, want)
+		}
+	})
+}